@@ -3,6 +3,8 @@ package env
 import (
 	"fmt"
 
+	"github.com/inercia/docker-env/env/config"
+
 	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/log"
 )
@@ -19,8 +21,8 @@ func printIP(h *host.Host) func() error {
 }
 
 // machineCommand maps the command name to the corresponding machine command.
-// We run commands concurrently and communicate back an error if there was one.
-func machineCommand(actionName string, host *host.Host, errorChan chan<- error) {
+// We run commands concurrently and return an error if there was one.
+func machineCommand(actionName string, host *host.Host) error {
 	// TODO: These actions should have their own type.
 	commands := map[string](func() error){
 		"configureAuth": host.ConfigureAuth,
@@ -34,32 +36,16 @@ func machineCommand(actionName string, host *host.Host, errorChan chan<- error)
 
 	log.Debugf("command=%s machine=%s", actionName, host.Name)
 
-	errorChan <- commands[actionName]()
+	return commands[actionName]()
 }
 
-// runActionForeachMachine will run the command across multiple machines
-func RunActionForeachMachine(actionName string, machines []*host.Host) []error {
-	var (
-		numConcurrentActions = 0
-		errorChan            = make(chan error)
-		errs                 = []error{}
-	)
-
-	for _, machine := range machines {
-		numConcurrentActions++
-		go machineCommand(actionName, machine, errorChan)
-	}
-
-	// TODO: We should probably only do 5-10 of these
-	// at a time, since otherwise cloud providers might
-	// rate limit us.
-	for i := 0; i < numConcurrentActions; i++ {
-		if err := <-errorChan; err != nil {
-			errs = append(errs, err)
-		}
-	}
-
-	close(errorChan)
-
-	return errs
+// RunActionForeachMachine will run the command across multiple machines,
+// with the limits in the DefaultScheduler and retrying it with the policy
+// of every machine
+func RunActionForeachMachine(actionName string, machines []*host.Host, policies func(string) config.RetryPolicy) []error {
+	return DefaultScheduler.RunForeachHost(machines, func(h *host.Host) error {
+		return Retry(policies(h.Name), actionName, h.Name, func() error {
+			return machineCommand(actionName, h)
+		})
+	})
 }
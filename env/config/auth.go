@@ -1,7 +1,6 @@
 package config
 
 import (
-	"bytes"
 	"path/filepath"
 
 	"github.com/docker/machine/commands/mcndirs"
@@ -12,6 +11,21 @@ import (
 
 type authConfig auth.Options
 
+// the keys that can be used in an "auth" section
+var authSchema = sectionSchema{
+	"cert-dir":                scalarValue,
+	"tls-ca-cert":             scalarValue,
+	"tls-ca-key":              scalarValue,
+	"tls-ca-cert-remote":      scalarValue,
+	"tls-client-cert":         scalarValue,
+	"tls-client-key":          scalarValue,
+	"server-cert-path":        scalarValue,
+	"server-key-path":         scalarValue,
+	"server-cert-remote-path": scalarValue,
+	"server-key-remote-path":  scalarValue,
+	"server-cert-SANs":        listValue,
+}
+
 func NewAuthConfig(_ libmachine.API) *authConfig {
 	certDir := mcndirs.GetMachineCertDir()
 	return &authConfig{
@@ -55,11 +69,31 @@ func (auth *authConfig) Populate(api libmachine.API, root *Config, machine *mach
 	return nil
 }
 
+func (auth authConfig) MarshalYAML() (interface{}, error) {
+	return nonEmptyTree(yaml.MapSlice{
+		{Key: "cert-dir", Value: auth.CertDir},
+		{Key: "tls-ca-cert", Value: auth.CaCertPath},
+		{Key: "tls-ca-key", Value: auth.CaPrivateKeyPath},
+		{Key: "tls-ca-cert-remote", Value: auth.CaCertRemotePath},
+		{Key: "tls-client-cert", Value: auth.ClientCertPath},
+		{Key: "tls-client-key", Value: auth.ClientKeyPath},
+		{Key: "server-cert-path", Value: auth.ServerCertPath},
+		{Key: "server-key-path", Value: auth.ServerKeyPath},
+		{Key: "server-cert-remote-path", Value: auth.ServerCertRemotePath},
+		{Key: "server-key-remote-path", Value: auth.ServerKeyRemotePath},
+		{Key: "server-cert-SANs", Value: auth.ServerCertSANs},
+	}), nil
+}
+
 func (auth *authConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	c := make(optionsMap)
-	if err := unmarshal(c); err != nil {
+	raw := make(map[string]interface{})
+	if err := unmarshal(raw); err != nil {
 		return err
 	}
+	c := make(map[string]string)
+	for k, v := range raw {
+		c[k] = toString(v)
+	}
 
 	// note: we must wait until Populate for setting default values, as some
 	//       of them depend on "cert-dir" and that could be changed on a later
@@ -96,9 +130,8 @@ func (auth *authConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if v, found := c["server-key-remote-path"]; found {
 		auth.ServerKeyRemotePath = v
 	}
-	if v, found := c["server-cert-SANs"]; found {
-		lst := []string{}
-		err := yaml.Unmarshal(bytes.NewBufferString(v).Bytes(), lst)
+	if v, found := raw["server-cert-SANs"]; found {
+		lst, err := toStringList(v)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Built-in variables
+//
+// Besides the instance number, $(#), some variables are always defined:
+//
+//   - "env.name": the environment names given in the command line (joined with "-")
+//   - "machine.basename": the name of the machine definition, without the instance number
+//   - "machine.index": the instance number (like "#"), starting at 1
+//   - "machine.index0": the instance number, starting at 0
+//   - "machine.count": the number of instances of the machine
+//   - "each.<name>": the values in a "for_each"
+//
+// Numeric variables can be formatted with a width, like in "$(#:03)" for "001".
+const (
+	envNameVar         = "env.name"
+	machineBasenameVar = "machine.basename"
+	machineIndexVar    = "machine.index"
+	machineIndex0Var   = "machine.index0"
+	machineCountVar    = "machine.count"
+)
+
+// check if a variable is the instance number
+func isIndexVar(name string) bool {
+	switch name {
+	case "#", machineIndexVar, machineIndex0Var:
+		return true
+	}
+	return false
+}
+
+// check if a variable is a "for_each" value
+func isEachVar(name string) bool {
+	return strings.HasPrefix(name, eachVarPrefix)
+}
+
+// check if a variable depends on the instance, so it is known only when expanding instances
+func isInstanceVar(name string) bool {
+	return isIndexVar(name) || isEachVar(name) || name == machineCountVar
+}
+
+// check if a string uses some variable for which a function returns true
+func hasVarsMatching(s string, f func(string) bool) bool {
+	for _, ref := range varRefs(s) {
+		if f(ref.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// get the built-in variables for a machine (or just the global ones when no machine is provided)
+func (config *Config) builtinVars(machine *machineConfig) map[string]string {
+	res := map[string]string{
+		envNameVar: strings.Join(config.environments, "-"),
+	}
+	if machine != nil {
+		res[machineBasenameVar] = machineBasename(machine.definition)
+	}
+	return res
+}
+
+// get the variables for an instance of a machine (with the values of a
+// combination in a "for_each"), replacing the instance variables in the
+// (resolved) variables provided
+func instanceVars(vars map[string]string, index, count int, each map[string]string) map[string]string {
+	builtins := map[string]string{
+		"#":              strconv.Itoa(index),
+		machineIndexVar:  strconv.Itoa(index),
+		machineIndex0Var: strconv.Itoa(index - 1),
+		machineCountVar:  strconv.Itoa(count),
+	}
+	for k, v := range each {
+		builtins[k] = v
+	}
+	res := map[string]string{}
+	for k, v := range vars {
+		res[k], _ = replaceVars(v, builtins)
+	}
+	for k, v := range builtins {
+		res[k] = v
+	}
+	return res
+}
+
+// get the name of a machine definition without the instance number,
+// so "worker-$(#:03)" is just "worker"
+func machineBasename(definition string) string {
+	res := replaceVarsFunc(definition, func(k string) string {
+		for _, ref := range varRefs(k) {
+			if isInstanceVar(ref.Name) {
+				return ""
+			}
+		}
+		return k
+	})
+	return strings.Trim(res, "-_.")
+}
+
+// format a numeric value with a width, like "3" or "03" (for padding with zeros)
+func formatVar(value, width string) (string, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not a number", value)
+	}
+	w, _ := strconv.Atoi(width)
+	if strings.HasPrefix(width, "0") {
+		return fmt.Sprintf("%0*d", w, n), nil
+	}
+	return fmt.Sprintf("%*d", w, n), nil
+}
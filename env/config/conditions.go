@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const whenKey = "when"
+
+// the sections in a machine definition that can have a "when" condition
+var conditionalSections = []string{"auth", "engine", "driver", "swarm"}
+
+func isConditionalSection(key string) bool {
+	for _, s := range conditionalSections {
+		if s == key {
+			return true
+		}
+	}
+	return false
+}
+
+// a machineConfig without the custom unmarshaller
+type plainMachineConfig machineConfig
+
+// UnmarshalYAML takes out the "when" conditions in the sections of the machine,
+// as well as the typed values with variables (see typedValue)
+func (machine *machineConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	tree := yaml.MapSlice{}
+	if err := unmarshal(&tree); err != nil {
+		return err
+	}
+
+	conditions := map[string]string{}
+	for i, item := range tree {
+		key := fmt.Sprint(item.Key)
+		section, ok := item.Value.(yaml.MapSlice)
+		if !ok || !isConditionalSection(key) {
+			continue
+		}
+		if j := treeIndex(section, whenKey); j >= 0 {
+			conditions[key] = toString(section[j].Value)
+			tree[i].Value = append(section[:j:j], section[j+1:]...)
+		}
+	}
+
+	tree, typed := extractTyped(tree)
+
+	b, err := yaml.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(b, (*plainMachineConfig)(machine)); err != nil {
+		return err
+	}
+	if len(conditions) > 0 {
+		machine.Conditions = conditions
+	}
+	if len(typed) > 0 {
+		machine.typed = typed
+	}
+	return nil
+}
+
+// the words accepted as booleans in conditions, besides the ones in strconv.ParseBool
+var conditionWords = map[string]bool{
+	"yes": true,
+	"y":   true,
+	"on":  true,
+	"no":  false,
+	"n":   false,
+	"off": false,
+}
+
+// evaluate a condition, after replacing variables, like "true" or "10 > 3"
+func evalCondition(s string) (bool, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return true, nil
+	}
+	if hasVars(s) {
+		return false, fmt.Errorf("undefined variables in condition '%s'", s)
+	}
+	if b, err := strconv.ParseBool(s); err == nil {
+		return b, nil
+	}
+	if b, found := conditionWords[strings.ToLower(s)]; found {
+		return b, nil
+	}
+
+	res, err := evalExpr(s, nil)
+	if err != nil {
+		if u, ok := err.(unknownVarsError); ok {
+			return false, fmt.Errorf("unknown value '%s' in condition '%s' (strings must be quoted)", u[0], s)
+		}
+		return false, err
+	}
+	b, err := strconv.ParseBool(res)
+	if err != nil {
+		return false, fmt.Errorf("the condition '%s' is not a boolean", s)
+	}
+	return b, nil
+}
+
+// evaluate the conditions in a machine (with variables already replaced),
+// removing the sections where the condition is false. It returns false
+// when the machine itself must be removed.
+func (machine *machineConfig) evalConditions(root *Config) (bool, error) {
+	keep, err := evalCondition(machine.When)
+	if err != nil {
+		return false, root.errorAt(keysPath(machinesKey, machine.definition, whenKey), machine.Name, "%s", err)
+	}
+	if !keep {
+		return false, nil
+	}
+
+	for section, condition := range machine.Conditions {
+		keep, err := evalCondition(condition)
+		if err != nil {
+			return false, root.errorAt(keysPath(machinesKey, machine.definition, section, whenKey), machine.Name, "%s", err)
+		}
+		if keep {
+			continue
+		}
+		// the section will be taken from the global configuration
+		machine.typed = machine.typed.without(section)
+		switch section {
+		case "auth":
+			machine.Auth = nil
+		case "engine":
+			machine.Engine = nil
+		case "driver":
+			machine.Driver = nil
+		case "swarm":
+			machine.Swarm = nil
+		}
+	}
+	machine.Conditions = nil
+	return true, nil
+}
@@ -0,0 +1,98 @@
+package config_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const test_config_conditions = `
+vars:
+  ENABLE_MONITORING: false
+  NUM_WORKERS: 3
+engine:
+  storage-driver: aufs
+machines:
+  monitoring:
+    instances: 1
+    when: $(ENABLE_MONITORING) == true
+  worker:
+    instances: $(NUM_WORKERS)
+    when: $(NUM_WORKERS > 0)
+    engine:
+      when: "'$(env.name)' == 'production'"
+      storage-driver: overlay
+  master:
+    instances: 1
+    when: $(ENABLE_MONITORING) || $(NUM_WORKERS) >= 3
+`
+
+func TestPopulateConditions(t *testing.T) {
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_conditions), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 4, "wrong number of machines")
+	require.NotContains(t, cfg.Machines, "monitoring", "monitoring must be removed")
+	require.Contains(t, cfg.Machines, "master", "master must not be removed")
+	require.Equal(t, "aufs", cfg.Machines["worker-1"].Engine.StorageDriver, "the engine section must be removed")
+
+	cfg = config.Config{}
+	err = yaml.Unmarshal([]byte(test_config_conditions), &cfg)
+	require.NoError(t, err, "config parsing error")
+	cfg.SetVar("ENABLE_MONITORING", "true", "the command line")
+	cfg.SetVar("NUM_WORKERS", "0", "the command line")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 2, "wrong number of machines")
+	require.Contains(t, cfg.Machines, "monitoring", "monitoring must not be removed")
+}
+
+func TestPopulateConditionsWords(t *testing.T) {
+	for value, keep := range map[string]bool{"yes": true, "On": true, "1": true, "no": false, "off": false, "False": false} {
+		cfg := config.Config{}
+		err := yaml.Unmarshal([]byte("machines: {master: {instances: 1, when: $(ENABLE_MONITORING)}}"), &cfg)
+		require.NoError(t, err, "config parsing error")
+		cfg.SetVar("ENABLE_MONITORING", value, "the command line")
+		require.NoError(t, cfg.Populate(nil, nil, nil), "error with '%s'", value)
+		if keep {
+			require.Contains(t, cfg.Machines, "master", "master must not be removed with '%s'", value)
+		} else {
+			require.NotContains(t, cfg.Machines, "master", "master must be removed with '%s'", value)
+		}
+	}
+}
+
+func TestPopulateConditionsErrors(t *testing.T) {
+	for _, when := range []string{"$(UNDEFINED)", "production == staging", "3 + 4", "maybe", "yes == true"} {
+		cfg := config.Config{}
+		err := yaml.Unmarshal([]byte("machines: {master: {instances: 1, when: '"+when+"'}}"), &cfg)
+		require.NoError(t, err, "config parsing error")
+		require.Error(t, cfg.Populate(nil, nil, nil), "error not detected in '%s'", when)
+	}
+}
+
+func TestValidateConditions(t *testing.T) {
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": test_config_conditions,
+	})
+	defer os.RemoveAll(dir)
+	require.NoError(t, err)
+
+	dir, err = loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+engine:
+  when: true
+machines:
+  master:
+    instances: 1
+`,
+	})
+	defer os.RemoveAll(dir)
+	require.Error(t, err, "conditions are not valid in global sections")
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"github.com/docker/machine/libmachine"
+	"gopkg.in/yaml.v2"
 )
 
 type varsMap map[string]string
@@ -11,11 +12,71 @@ type optionsMap map[string]string
 // Config is a configuration for an environment
 type Config struct {
 	Vars     varsMap          `yaml:"vars,omitempty"`
+	VarFiles []string         `yaml:"var-files,omitempty"`
+	Secrets  varsMap          `yaml:"secrets,omitempty"`
+	Parallel int              `yaml:"parallel,omitempty"`
+	Retry    *retryConfig     `yaml:"retry,omitempty"`
 	Auth     *authConfig      `yaml:"auth,omitempty"`
 	Engine   *engineConfig    `yaml:"engine,omitempty"`
 	Driver   *driverConfig    `yaml:"driver,omitempty"`
 	Swarm    *swarmConfig     `yaml:"swarm,omitempty"`
 	Machines machineConfigMap `yaml:"machines,omitempty"`
+
+	// the merged tree this configuration was decoded from (if any)
+	tree yaml.MapSlice
+	// the positions of the keys of the tree in the configuration files
+	positions positionsMap
+	// all the values loaded from files, for explaining where values come from
+	history historyMap
+	// the definitions extended by every machine definition
+	extends extendsMap
+	// the sources of the variables that were not loaded from files
+	varSources map[string]string
+	// the names of the environments loaded
+	environments []string
+	// the typed values with variables in the global sections
+	typed typedValues
+	// if references to undefined variables are allowed
+	allowUndefined bool
+	// the (decrypted) secrets
+	secrets map[string]string
+}
+
+// a Config without the custom unmarshaller
+type plainConfig Config
+
+// UnmarshalYAML takes out the typed values with variables in the global
+// sections (see typedValue), as they are decoded for every machine
+func (config *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	tree := yaml.MapSlice{}
+	if err := unmarshal(&tree); err != nil {
+		return err
+	}
+	tree, typed := extractTyped(tree)
+
+	b, err := yaml.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(b, (*plainConfig)(config)); err != nil {
+		return err
+	}
+	config.typed = append(config.typed.drop(tree), typed...)
+	return nil
+}
+
+// the keys that can be used at the top level of the configuration
+var configSchema = sectionSchema{
+	"vars":      mapValue,
+	"var-files": listValue,
+	"secrets":   mapValue,
+	"parallel":  intValue,
+	"retry":     mapValue,
+	"auth":      mapValue,
+	"engine":    mapValue,
+	"driver":    mapValue,
+	"swarm":     mapValue,
+	"machines":  mapValue,
 }
 
 type Populater interface {
@@ -36,11 +97,18 @@ func (config *Config) Populate(api libmachine.API, _ *Config, _ *machineConfig)
 		config.Swarm = NewSwarmConfig(api)
 	}
 
+	// check the global variables, even if they are not used by any machine
+	// (references to undefined variables are reported with the ones in machines)
+	undefined := validator{config: config}
+	if _, err := config.resolveVars(nil, &undefined); err != nil {
+		return err
+	}
+
 	// replace all the constants
-	for _, p := range []Populater{config.Auth, config.Engine, config.Driver, config.Swarm, config.Machines} {
+	for _, p := range []Populater{config.Auth, config.Engine, config.Driver, config.Swarm} {
 		if err := p.Populate(api, config, nil); err != nil {
 			return err
 		}
 	}
-	return nil
+	return config.Machines.populate(api, config, &undefined)
 }
@@ -2,6 +2,7 @@ package config_test
 
 import (
 	"bytes"
+	"os"
 	"testing"
 
 	"github.com/inercia/docker-env/env/config"
@@ -213,3 +214,122 @@ machines:
 
 	scs.Dump(config)
 }
+
+func TestPopulateVarsModifiers(t *testing.T) {
+	const test_config_modifiers = `
+machines:
+  worker:
+    instances: $(NUM_WORKERS:-2)
+    swarm:
+      discovery: $(SWARM_DISCOVERY:?a discovery token is needed)
+`
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_modifiers), &cfg)
+	require.NoError(t, err, "config parsing error")
+
+	cfg.SetVar("SWARM_DISCOVERY", "token://1234", "the command line")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+	require.Len(t, cfg.Machines, 2, "wrong number of machines")
+	require.Equal(t, "token://1234", cfg.Machines["worker-1"].Swarm.Discovery, "swarm discovery mismatch")
+
+	cfg = config.Config{}
+	err = yaml.Unmarshal([]byte(test_config_modifiers), &cfg)
+	require.NoError(t, err, "config parsing error")
+
+	err = cfg.Populate(nil, nil, nil)
+	require.Error(t, err, "missing required variable not detected")
+	require.Contains(t, err.Error(), "a discovery token is needed")
+}
+
+func TestPopulateExpressions(t *testing.T) {
+	const test_config_expressions = `
+vars:
+  NUM_WORKERS: 2
+driver:
+  virtualbox:
+    memory: $(# * 1024)
+machines:
+  worker-$(# + 10):
+    instances: $(NUM_WORKERS * 2)
+    engine:
+      labels: [index=$(#), tier=$(upper('small'))]
+`
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_expressions), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 4, "wrong number of machines")
+	worker, found := cfg.Machines["worker-13"]
+	require.True(t, found, "worker-13 not found")
+	require.Equal(t, []string{"index=3", "tier=SMALL"}, worker.Engine.Labels, "labels mismatch")
+	require.Equal(t, 3072, worker.Driver.Options["memory"], "memory mismatch")
+}
+
+func TestPopulateMachineVars(t *testing.T) {
+	const test_config_machine_vars = `
+vars:
+  DISK:      20
+  HOST:      host
+  DISCOVERY: consul://$(HOST):8500
+driver:
+  virtualbox:
+    disk-size: $(DISK)
+machines:
+  database:
+    instances: 2
+    vars:
+      DISK: $(BASE_DISK * 10)
+      BASE_DISK: 20
+      HOST: db-$(#)
+    swarm:
+      discovery: $(DISCOVERY)
+  worker:
+    instances: 1
+`
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_machine_vars), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 3, "wrong number of machines")
+	database := cfg.Machines["database-2"]
+	require.Equal(t, 200, database.Driver.Options["disk-size"], "machine variables must shadow the global ones")
+	require.Equal(t, "consul://db-2:8500", database.Swarm.Discovery, "global variables must see the machine variables")
+	require.Equal(t, 20, cfg.Machines["worker"].Driver.Options["disk-size"], "disk size mismatch")
+}
+
+func TestPopulateBuiltinVars(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+vars:
+  HOST: $(machine.basename)-$(#:02)
+engine:
+  labels: [env=$(env.name), host=$(HOST)]
+machines:
+  worker-$(#:03):
+    instances: 3
+    driver:
+      virtualbox:
+        memory: $(machine.index0 * 1024)
+        disk-size: $(machine.count)
+`,
+		"docker-env-production.yml": `
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load([]string{"production"})
+	require.NoError(t, err)
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 3, "wrong number of machines")
+	worker, found := cfg.Machines["worker-002"]
+	require.True(t, found, "worker-002 not found")
+	require.Equal(t, []string{"env=production", "host=worker-02"}, worker.Engine.Labels, "labels mismatch")
+	require.Equal(t, 1024, worker.Driver.Options["memory"], "memory mismatch")
+	require.Equal(t, 3, worker.Driver.Options["disk-size"], "disk size mismatch")
+}
@@ -3,7 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
-
+	"strconv"
 	"strings"
 
 	"github.com/docker/machine/commands/mcndirs"
@@ -12,14 +12,34 @@ import (
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/drivers/rpc"
 	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnflag"
+	"gopkg.in/yaml.v2"
 )
 
 type driverOptions map[string]interface{}
 
-func (d driverOptions) String(key string) string        { return d[key].(string) }
-func (d driverOptions) StringSlice(key string) []string { return d[key].([]string) }
-func (d driverOptions) Int(key string) int              { return d[key].(int) }
-func (d driverOptions) Bool(key string) bool            { return d[key].(bool) }
+func (d driverOptions) String(key string) string { return toString(d[key]) }
+
+func (d driverOptions) StringSlice(key string) []string {
+	lst, _ := toStringList(d[key])
+	return lst
+}
+
+func (d driverOptions) Int(key string) int {
+	if v, ok := d[key].(int); ok {
+		return v
+	}
+	v, _ := strconv.Atoi(toString(d[key]))
+	return v
+}
+
+func (d driverOptions) Bool(key string) bool {
+	if v, ok := d[key].(bool); ok {
+		return v
+	}
+	v, _ := strconv.ParseBool(toString(d[key]))
+	return v
+}
 
 type driverConfig struct {
 	Name    string
@@ -44,6 +64,13 @@ func (driver *driverConfig) Populate(api libmachine.API, root *Config, machine *
 	return nil
 }
 
+func (driver driverConfig) MarshalYAML() (interface{}, error) {
+	if len(driver.Name) == 0 {
+		return yaml.MapSlice{}, nil
+	}
+	return yaml.MapSlice{{Key: driver.Name, Value: driver.Options}}, nil
+}
+
 func (driver *driverConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	c := make(map[string]driverOptions)
 	if err := unmarshal(c); err != nil {
@@ -63,8 +90,8 @@ func (driver *driverConfig) UnmarshalYAML(unmarshal func(interface{}) error) err
 	return nil
 }
 
-// Get a plugin driver
-func (driver *driverConfig) Get(api libmachine.API) (drivers.Driver, error) {
+// Load the plugin driver (without any configuration)
+func (driver *driverConfig) plugin(api libmachine.API) (drivers.Driver, error) {
 	bareDriverData, err := json.Marshal(&drivers.BaseDriver{
 		MachineName: driver.machine.Name,
 		StorePath:   mcndirs.GetBaseDir(),
@@ -79,7 +106,35 @@ func (driver *driverConfig) Get(api libmachine.API) (drivers.Driver, error) {
 		return nil, fmt.Errorf("Error loading '%s' driver: %s", driver.Name, err)
 	}
 	if _, ok := d.(*errdriver.Driver); ok {
-		return nil, errdriver.NotLoadable{driver.Name}
+		return nil, errdriver.NotLoadable{Name: driver.Name}
+	}
+	return d, nil
+}
+
+// Get the create flags of a driver, by their name without the driver prefix
+func driverFlags(driverName string, d drivers.Driver) (map[string]mcnflag.Flag, error) {
+	res := map[string]mcnflag.Flag{}
+	prefix := fmt.Sprintf("%s-", driverName)
+	for _, f := range d.GetCreateFlags() {
+		flagName := f.String()
+		if !strings.HasPrefix(flagName, prefix) {
+			return nil, fmt.Errorf("Flag '%s' does not start with '%s'", f, prefix)
+		}
+		res[flagName[len(prefix):]] = f
+	}
+	return res, nil
+}
+
+// Get a plugin driver
+func (driver *driverConfig) Get(api libmachine.API) (drivers.Driver, error) {
+	d, err := driver.plugin(api)
+	if err != nil {
+		return nil, err
+	}
+
+	mcnFlags, err := driverFlags(driver.Name, d)
+	if err != nil {
+		return nil, err
 	}
 
 	// We need it so that we can actually send the flags for creating
@@ -89,15 +144,8 @@ func (driver *driverConfig) Get(api libmachine.API) (drivers.Driver, error) {
 		Values: make(map[string]interface{}),
 	}
 
-	mcnFlags := d.GetCreateFlags()
-	for _, f := range mcnFlags {
+	for flagWithoutDriver, f := range mcnFlags {
 		flagName := f.String()
-		prefix := fmt.Sprintf("%s-", driver.Name)
-		if !strings.HasPrefix(flagName, prefix) {
-			panic(fmt.Sprintf("Flag '%s' does not start with '%s'", f, prefix))
-		}
-
-		flagWithoutDriver := flagName[len(prefix):]
 		value, found := driver.Options[flagWithoutDriver]
 		if found {
 			log.Debugf("Setting %s = %s", flagName, value)
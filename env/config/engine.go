@@ -2,6 +2,7 @@ package config
 
 import (
 	"bytes"
+	"fmt"
 	"strconv"
 
 	"github.com/docker/machine/libmachine"
@@ -17,6 +18,20 @@ const (
 
 type engineConfig engine.Options
 
+// the keys that can be used in an "engine" section
+var engineSchema = sectionSchema{
+	"opt":              listValue,
+	"environment":      listValue,
+	"dns":              listValue,
+	"labels":           listValue,
+	"storage-driver":   scalarValue,
+	"se-linux-enabled": boolValue,
+	"tls-verify":       boolValue,
+	"ipv6":             boolValue,
+	"install-url":      scalarValue,
+	"log-level":        scalarValue,
+}
+
 func NewEngineConfig(_ libmachine.API) *engineConfig {
 	return &engineConfig{
 		StorageDriver:    defaultEngineStorageDriver,
@@ -40,6 +55,34 @@ func parseStringList(s string) ([]string, error) {
 	return lst, nil
 }
 
+// get a list of strings from a YAML list, a string with a YAML list or a single value
+func toStringList(v interface{}) ([]string, error) {
+	switch vv := v.(type) {
+	case nil:
+		return []string{}, nil
+	case []interface{}:
+		lst := []string{}
+		for _, e := range vv {
+			lst = append(lst, toString(e))
+		}
+		return lst, nil
+	case string:
+		if lst, err := parseStringList(vv); err == nil {
+			return lst, nil
+		}
+		return []string{vv}, nil
+	default:
+		return []string{toString(v)}, nil
+	}
+}
+
+func toString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
 func (engine engineConfig) Copy() *engineConfig {
 	return &engine
 }
@@ -50,35 +93,54 @@ func (engine *engineConfig) Populate(api libmachine.API, root *Config, machine *
 	return nil
 }
 
+func (engine engineConfig) MarshalYAML() (interface{}, error) {
+	return nonEmptyTree(yaml.MapSlice{
+		{Key: "opt", Value: engine.ArbitraryFlags},
+		{Key: "environment", Value: engine.Env},
+		{Key: "dns", Value: engine.DNS},
+		{Key: "labels", Value: engine.Labels},
+		{Key: "storage-driver", Value: engine.StorageDriver},
+		{Key: "se-linux-enabled", Value: engine.SelinuxEnabled},
+		{Key: "tls-verify", Value: engine.TLSVerify},
+		{Key: "ipv6", Value: engine.Ipv6},
+		{Key: "install-url", Value: engine.InstallURL},
+		{Key: "log-level", Value: engine.LogLevel},
+	}), nil
+}
+
 func (engine *engineConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	c := make(map[string]string)
-	if err := unmarshal(c); err != nil {
+	raw := make(map[string]interface{})
+	if err := unmarshal(raw); err != nil {
 		return err
 	}
+	c := make(map[string]string)
+	for k, v := range raw {
+		c[k] = toString(v)
+	}
 
-	if v, found := c["opt"]; found {
-		lst, err := parseStringList(v)
+	if v, found := raw["opt"]; found {
+		lst, err := toStringList(v)
 		if err != nil {
 			return err
 		}
 		engine.ArbitraryFlags = lst
 	}
-	if v, found := c["environment"]; found {
-		lst, err := parseStringList(v)
+	if v, found := raw["environment"]; found {
+		lst, err := toStringList(v)
 		if err != nil {
 			return err
 		}
 		engine.Env = lst
 	}
-	if v, found := c["dns"]; found {
-		lst, err := parseStringList(v)
+	if v, found := raw["dns"]; found {
+		lst, err := toStringList(v)
 		if err != nil {
 			return err
 		}
 		engine.DNS = lst
 	}
-	if v, found := c["labels"]; found {
-		lst, err := parseStringList(v)
+	if v, found := raw["labels"]; found {
+		lst, err := toStringList(v)
 		if err != nil {
 			return err
 		}
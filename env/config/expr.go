@@ -0,0 +1,569 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Expressions can be used in variables, like in "$(NUM_WORKERS * 2)"
+//
+// An expression can use integers, strings (between double or single quotes),
+// booleans (true and false), variables (including "#" for the instance number,
+// "env:NAME" for environment variables and "secret:NAME" for secrets),
+// parenthesis, the arithmetic operators "+ - * / %", the comparisons
+// "== != < <= > >=", the boolean operators "&& || !" and the functions:
+//
+//   upper(s), lower(s), join(sep, s, ...), replace(s, old, new), default(v, d)
+//
+// Variables are strings, converted to integers (or booleans) when they are
+// used in arithmetic (or boolean) operations. The result is always a string.
+
+// a plain variable name, like "NUM_WORKERS", "env:HOME", "secret:TOKEN" or "#"
+var plainVarRegexp = regexp.MustCompile(`^(#|(env:|secret:)?[A-Za-z_][A-Za-z0-9_.]*)$`)
+
+// exprError is returned when an expression cannot be parsed or evaluated
+type exprError struct {
+	Expr    string
+	Message string
+}
+
+func (e exprError) Error() string {
+	return fmt.Sprintf("invalid expression '%s': %s", e.Expr, e.Message)
+}
+
+// check if the contents of a "$(...)" is an expression (and not just a
+// variable, with or without a modifier like in "NAME:-default")
+func isExpr(s string, vars map[string]string) bool {
+	if _, found := vars[s]; found || plainVarRegexp.MatchString(s) {
+		return false
+	}
+	ref := parseVarRef(s)
+	if len(ref.Op) > 0 && plainVarRegexp.MatchString(ref.Name) {
+		return false
+	}
+	return true
+}
+
+// evaluate an expression, returning an unknownVarsError when some variable is not defined
+func evalExpr(s string, vars map[string]string) (string, error) {
+	node, _, err := parseExpr(s)
+	if err != nil {
+		return "", err
+	}
+	v, err := node.eval(vars)
+	if err != nil {
+		if _, ok := err.(unknownVarsError); ok {
+			return "", err
+		}
+		return "", exprError{Expr: s, Message: err.Error()}
+	}
+	return exprString(v), nil
+}
+
+// parse an expression, returning also the variables it uses
+func parseExpr(s string) (exprNode, []string, error) {
+	tokens, err := tokenizeExpr(s)
+	if err != nil {
+		return nil, nil, exprError{Expr: s, Message: err.Error()}
+	}
+	p := exprParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err == nil && p.peek().kind != tokEOF {
+		err = fmt.Errorf("unexpected '%s'", p.peek().text)
+	}
+	if err != nil {
+		return nil, nil, exprError{Expr: s, Message: err.Error()}
+	}
+	return node, p.vars, nil
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokInt
+	tokString
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// operators, with the longest ones first
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")", ","}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '.' || (c >= '0' && c <= '9')
+}
+
+func tokenizeExpr(s string) ([]token, error) {
+	res := []token{}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			res = append(res, token{kind: tokInt, text: s[i:j]})
+			i = j
+		case c == '"' || c == '\'':
+			j := strings.IndexByte(s[i+1:], c)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			res = append(res, token{kind: tokString, text: s[i+1 : i+1+j]})
+			i += j + 2
+		case c == '#':
+			res = append(res, token{kind: tokIdent, text: "#"})
+			i++
+		case isIdentStart(c):
+			j := i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			// environment variables and secrets, like "env:HOME" or "secret:TOKEN"
+			if (s[i:j] == "env" || s[i:j] == "secret") && j+1 < len(s) && s[j] == ':' && isIdentStart(s[j+1]) {
+				for j++; j < len(s) && isIdentChar(s[j]); j++ {
+				}
+			}
+			res = append(res, token{kind: tokIdent, text: s[i:j]})
+			i = j
+		default:
+			found := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(s[i:], op) {
+					res = append(res, token{kind: tokOp, text: op})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character '%c'", c)
+			}
+		}
+	}
+	return append(res, token{kind: tokEOF, text: "end of expression"}), nil
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	// the variables used in the expression
+	vars []string
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// consume the next token if it is one of some operators
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return fmt.Errorf("'%s' expected but '%s' found", op, p.peek().text)
+	}
+	return nil
+}
+
+// parse a sequence of binary operations with the same precedence
+func (p *exprParser) parseBinary(ops []string, operand func() (exprNode, error)) (exprNode, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return x, nil
+		}
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{op: op, x: x, y: y}
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	return p.parseBinary([]string{"||"}, p.parseAnd)
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	return p.parseBinary([]string{"&&"}, p.parseComparison)
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	return p.parseBinary([]string{"==", "!=", "<=", ">=", "<", ">"}, p.parseSum)
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	return p.parseBinary([]string{"+", "-"}, p.parseProduct)
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	return p.parseBinary([]string{"*", "/", "%"}, p.parseUnary)
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.accept("-", "!"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{op: op, x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(t.text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", t.text)
+		}
+		return literalNode{value: n}, nil
+	case tokString:
+		return literalNode{value: t.text}, nil
+	case tokIdent:
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(t.text)
+		}
+		if t.text == "true" || t.text == "false" {
+			return literalNode{value: t.text == "true"}, nil
+		}
+		p.vars = append(p.vars, t.text)
+		return varNode{name: t.text}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%s'", t.text)
+}
+
+// parse the arguments of a function call (the "(" has already been consumed)
+func (p *exprParser) parseCall(name string) (exprNode, error) {
+	f, found := exprFunctions[name]
+	if !found {
+		return nil, fmt.Errorf("unknown function '%s'", name)
+	}
+	args := []exprNode{}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	if len(args) < f.minArgs || (f.maxArgs >= 0 && len(args) > f.maxArgs) {
+		return nil, fmt.Errorf("wrong number of arguments for '%s'", name)
+	}
+	return callNode{name: name, f: f, args: args}, nil
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// an expression, evaluated to an int64, a string or a bool
+type exprNode interface {
+	eval(vars map[string]string) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(vars map[string]string) (interface{}, error) {
+	return n.value, nil
+}
+
+type varNode struct {
+	name string
+}
+
+func (n varNode) eval(vars map[string]string) (interface{}, error) {
+	v, found := lookupVar(vars, n.name)
+	if !found {
+		return nil, unknownVarsError{n.name}
+	}
+	return v, nil
+}
+
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (n unaryNode) eval(vars map[string]string) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		b, err := exprBool(x)
+		return !b, err
+	}
+	i, err := exprInt(x)
+	return -i, err
+}
+
+type binaryNode struct {
+	op   string
+	x, y exprNode
+}
+
+func (n binaryNode) eval(vars map[string]string) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// boolean operators are short-circuited
+	if n.op == "&&" || n.op == "||" {
+		b, err := exprBool(x)
+		if err != nil || b == (n.op == "||") {
+			return b, err
+		}
+		y, err := n.y.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		return exprBool(y)
+	}
+
+	y, err := n.y.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		var cmp int
+		xi, errx := exprInt(x)
+		yi, erry := exprInt(y)
+		if errx == nil && erry == nil {
+			cmp = compareInts(xi, yi)
+		} else {
+			cmp = compareStrings(exprString(x), exprString(y))
+		}
+		switch n.op {
+		case "==":
+			return cmp == 0, nil
+		case "!=":
+			return cmp != 0, nil
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		}
+		return cmp >= 0, nil
+	}
+
+	xi, err := exprInt(x)
+	if err != nil {
+		return nil, err
+	}
+	yi, err := exprInt(y)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "+":
+		return xi + yi, nil
+	case "-":
+		return xi - yi, nil
+	case "*":
+		return xi * yi, nil
+	}
+	if yi == 0 {
+		return nil, fmt.Errorf("division by zero")
+	}
+	if n.op == "/" {
+		return xi / yi, nil
+	}
+	return xi % yi, nil
+}
+
+type exprFunction struct {
+	minArgs, maxArgs int // maxArgs < 0 for any number of arguments
+	call             func(args []exprNode, vars map[string]string) (interface{}, error)
+}
+
+type callNode struct {
+	name string
+	f    exprFunction
+	args []exprNode
+}
+
+func (n callNode) eval(vars map[string]string) (interface{}, error) {
+	return n.f.call(n.args, vars)
+}
+
+// evaluate the arguments of a function as strings
+func evalStrings(args []exprNode, vars map[string]string) ([]string, error) {
+	res := []string{}
+	for _, arg := range args {
+		v, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, exprString(v))
+	}
+	return res, nil
+}
+
+// a function that takes strings and returns a string
+func stringsFunction(minArgs, maxArgs int, f func([]string) string) exprFunction {
+	return exprFunction{
+		minArgs: minArgs,
+		maxArgs: maxArgs,
+		call: func(args []exprNode, vars map[string]string) (interface{}, error) {
+			values, err := evalStrings(args, vars)
+			if err != nil {
+				return nil, err
+			}
+			return f(values), nil
+		},
+	}
+}
+
+var exprFunctions map[string]exprFunction
+
+func init() {
+	exprFunctions = map[string]exprFunction{
+		"upper": stringsFunction(1, 1, func(args []string) string {
+			return strings.ToUpper(args[0])
+		}),
+		"lower": stringsFunction(1, 1, func(args []string) string {
+			return strings.ToLower(args[0])
+		}),
+		"join": stringsFunction(1, -1, func(args []string) string {
+			return strings.Join(args[1:], args[0])
+		}),
+		"replace": stringsFunction(3, 3, func(args []string) string {
+			return strings.Replace(args[0], args[1], args[2], -1)
+		}),
+		// the default value is used when the value is undefined or empty
+		"default": {
+			minArgs: 2,
+			maxArgs: 2,
+			call: func(args []exprNode, vars map[string]string) (interface{}, error) {
+				v, err := args[0].eval(vars)
+				if _, ok := err.(unknownVarsError); ok || (err == nil && exprString(v) == "") {
+					return args[1].eval(vars)
+				}
+				return v, err
+			},
+		},
+	}
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func exprString(v interface{}) string {
+	switch vv := v.(type) {
+	case int64:
+		return strconv.FormatInt(vv, 10)
+	case bool:
+		return strconv.FormatBool(vv)
+	}
+	return fmt.Sprint(v)
+}
+
+func exprInt(v interface{}) (int64, error) {
+	switch vv := v.(type) {
+	case int64:
+		return vv, nil
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(vv), 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("'%s' is not a number", exprString(v))
+}
+
+func exprBool(v interface{}) (bool, error) {
+	switch vv := v.(type) {
+	case bool:
+		return vv, nil
+	case string:
+		if b, err := strconv.ParseBool(strings.TrimSpace(vv)); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("'%s' is not a boolean", exprString(v))
+}
+
+func compareInts(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareStrings(x, y string) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
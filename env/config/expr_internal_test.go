@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExprEval(t *testing.T) {
+	vars := map[string]string{
+		"NUM_WORKERS": "5",
+		"TIER":        "Large",
+		"EMPTY":       "",
+		"#":           "3",
+	}
+
+	for expr, expected := range map[string]string{
+		"NUM_WORKERS * 2":                  "10",
+		"(NUM_WORKERS + 1) * 2 - 10 / 3":   "9",
+		"NUM_WORKERS % 2":                  "1",
+		"-NUM_WORKERS":                     "-5",
+		"# * 1024":                         "3072",
+		"NUM_WORKERS > 3":                  "true",
+		"NUM_WORKERS == 10":                "false",
+		"TIER != 'small' && # <= 3":        "true",
+		"!(TIER == \"Large\") || # == 1":   "false",
+		"upper(TIER)":                      "LARGE",
+		"lower(TIER)":                      "large",
+		"join('-', 'worker', lower(TIER))": "worker-large",
+		"replace(TIER, 'Lar', 'Hu')":       "Huge",
+		"default(UNKNOWN, 'none')":         "none",
+		"default(EMPTY, 2) + 1":            "3",
+		"default(TIER, 'none')":            "Large",
+	} {
+		replaced, err := evalExpr(expr, vars)
+		require.NoError(t, err, "error evaluating '%s'", expr)
+		require.Equal(t, expected, replaced, "wrong result for '%s'", expr)
+	}
+
+	_, err := evalExpr("UNKNOWN * 2", vars)
+	require.IsType(t, unknownVarsError{}, err)
+
+	for _, expr := range []string{
+		"TIER * 2",
+		"NUM_WORKERS / 0",
+		"NUM_WORKERS +",
+		"(NUM_WORKERS",
+		"unknown(TIER)",
+		"upper(TIER, TIER)",
+		"'unterminated",
+		"NUM_WORKERS ^ 2",
+	} {
+		_, err := evalExpr(expr, vars)
+		require.Error(t, err, "error not detected in '%s'", expr)
+		require.IsType(t, exprError{}, err, "wrong error for '%s'", expr)
+	}
+}
+
+func TestReplaceVarsExpr(t *testing.T) {
+	vars := map[string]string{
+		"NUM_WORKERS": "5",
+	}
+
+	replaced, err := replaceVars("instances: $(NUM_WORKERS * 2), name: worker-$(#)", vars)
+	require.IsType(t, unknownVarsError{}, err)
+	require.Equal(t, "instances: 10, name: worker-$(#)", replaced)
+
+	_, err = replaceVars("$(NUM_WORKERS * 'a')", vars)
+	require.IsType(t, exprError{}, err)
+
+	require.True(t, hasVar("worker-$(# + 10)", "#"))
+	require.False(t, hasVar("worker-$(NUM_WORKERS)", "#"))
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	forEachKey = "for_each"
+
+	// the prefix for the variables with the elements in a "for_each", like "$(each.region)"
+	eachVarPrefix = "each."
+	// the name of the variable for a "for_each" with a plain list
+	eachValueName = "value"
+)
+
+// forEachDimension is a list of values in a "for_each", exposed in the
+// variable "each.<name>"
+type forEachDimension struct {
+	Name   string
+	Values []string
+}
+
+// forEachConfig is a "for_each" in a machine definition: a list of values
+// (exposed as "$(each.value)") or a map of lists, like
+//
+//	for_each:
+//	  region: [tor01, dal05]
+//	  tier:   [a, b]
+//
+// that is expanded to the cartesian product of all the lists.
+type forEachConfig []forEachDimension
+
+func (f *forEachConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var m yaml.MapSlice
+	if err := unmarshal(&m); err == nil {
+		res := forEachConfig{}
+		for _, item := range m {
+			values, err := toStringList(item.Value)
+			if err != nil {
+				return fmt.Errorf("invalid values for '%v' in '%s': %s", item.Key, forEachKey, err)
+			}
+			res = append(res, forEachDimension{Name: fmt.Sprint(item.Key), Values: values})
+		}
+		*f = res
+		return nil
+	}
+
+	var raw interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	values, err := toStringList(raw)
+	if err != nil {
+		return fmt.Errorf("invalid '%s': %s", forEachKey, err)
+	}
+	*f = forEachConfig{{Name: eachValueName, Values: values}}
+	return nil
+}
+
+func (f forEachConfig) MarshalYAML() (interface{}, error) {
+	if len(f) == 1 && f[0].Name == eachValueName {
+		return f[0].Values, nil
+	}
+	res := yaml.MapSlice{}
+	for _, d := range f {
+		res = append(res, yaml.MapItem{Key: d.Name, Value: d.Values})
+	}
+	return res, nil
+}
+
+// expand the lists given as a single value after replacing variables,
+// like in "region: $(REGIONS)" with "REGIONS: [tor01, dal05]"
+func (f forEachConfig) expand() (forEachConfig, error) {
+	res := forEachConfig{}
+	for _, d := range f {
+		values := d.Values
+		if len(values) == 1 {
+			var err error
+			if values, err = toStringList(values[0]); err != nil {
+				return nil, fmt.Errorf("invalid values for '%s' in '%s': %s", d.Name, forEachKey, err)
+			}
+		}
+		res = append(res, forEachDimension{Name: d.Name, Values: values})
+	}
+	return res, nil
+}
+
+// get all the combinations of values, as the variables for every combination
+func (f forEachConfig) combinations() []map[string]string {
+	res := []map[string]string{{}}
+	for _, d := range f {
+		next := []map[string]string{}
+		for _, combination := range res {
+			for _, v := range d.Values {
+				c := map[string]string{eachVarPrefix + d.Name: v}
+				for k, cv := range combination {
+					c[k] = cv
+				}
+				next = append(next, c)
+			}
+		}
+		res = next
+	}
+	return res
+}
+
+// the suffix for the names of machines that do not use the "for_each" variables,
+// like "-$(each.region)-$(each.tier)"
+func (f forEachConfig) nameSuffix() string {
+	res := []string{}
+	for _, d := range f {
+		res = append(res, fmt.Sprintf("$(%s%s)", eachVarPrefix, d.Name))
+	}
+	return "-" + strings.Join(res, "-")
+}
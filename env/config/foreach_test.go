@@ -0,0 +1,86 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPopulateForEach(t *testing.T) {
+	const test_config_for_each = `
+vars:
+  REGIONS: "[tor01, dal05]"
+machines:
+  web:
+    instances: 2
+    for_each:
+      region: $(REGIONS)
+      tier:   [a, b]
+    driver:
+      softlayer:
+        region: $(each.region)
+    engine:
+      labels: [tier=$(each.tier), index=$(#)]
+  db-$(each.value):
+    for_each: [mysql, redis]
+    instances: 1
+`
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_for_each), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 2*2*2+2, "wrong number of machines")
+	for _, name := range []string{"web-tor01-a-1", "web-tor01-b-2", "web-dal05-a-2", "db-mysql", "db-redis"} {
+		require.Contains(t, cfg.Machines, name, "%s not found", name)
+	}
+
+	web := cfg.Machines["web-dal05-b-2"]
+	require.Equal(t, "dal05", web.Driver.Options["region"], "region mismatch")
+	require.Equal(t, []string{"tier=b", "index=2"}, web.Engine.Labels, "labels mismatch")
+}
+
+func TestPopulateForEachDuplicates(t *testing.T) {
+	const test_config_for_each = `
+machines:
+  web:
+    for_each: [a, a]
+    instances: 1
+`
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_for_each), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.Error(t, cfg.Populate(nil, nil, nil), "duplicate names not detected")
+}
+
+func TestPopulateForEachWithoutInstances(t *testing.T) {
+	// the example in the README
+	const test_config_for_each = `
+machines:
+  web:
+    instances: 2
+    for_each:
+      region: [tor01, dal05]
+      tier:   [a, b]
+    driver:
+      softlayer:
+        region: $(each.region)
+  db-$(each.value):
+    for_each: [mysql, redis]
+`
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_for_each), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 2*2*2+2, "wrong number of machines")
+	for _, name := range []string{"web-tor01-a-1", "web-tor01-a-2", "web-tor01-b-1", "db-mysql", "db-redis"} {
+		require.Contains(t, cfg.Machines, name, "%s not found", name)
+	}
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	machinesKey  = "machines"
+	templatesKey = "templates"
+)
+
+// ResolveExtends resolves the inheritance between machines in a configuration tree
+//
+// A machine (in the "machines" section) or a template (in the "templates"
+// section) can "extend" one or more machines or templates, inheriting all
+// their keys and overriding only what it specifies. Parents are resolved
+// before their children, and multiple parents are merged in the order given
+// (so the last one takes precedence), followed by the machine itself.
+// Machines and templates share the same namespace, but templates are never
+// created: the "templates" section is removed from the resulting tree.
+//
+// Sections that are still missing after the inheritance will be taken from the
+// global sections when populating the configuration.
+func ResolveExtends(tree yaml.MapSlice, opts MergeOptions) (yaml.MapSlice, error) {
+	res, _, err := resolveExtends(tree, opts)
+	return res, err
+}
+
+// resolve the inheritance, returning also the parents of every definition
+func resolveExtends(tree yaml.MapSlice, opts MergeOptions) (yaml.MapSlice, extendsMap, error) {
+	defs := map[string]yaml.MapSlice{}
+
+	sections := map[string]yaml.MapSlice{}
+	for _, section := range []string{templatesKey, machinesKey} {
+		i := treeIndex(tree, section)
+		if i < 0 || tree[i].Value == nil {
+			continue
+		}
+		machines, ok := tree[i].Value.(yaml.MapSlice)
+		if !ok {
+			return nil, nil, fmt.Errorf("the '%s' section must be a map of machines", section)
+		}
+		sections[section] = machines
+		for _, item := range machines {
+			name := fmt.Sprint(item.Key)
+			if _, found := defs[name]; found {
+				return nil, nil, fmt.Errorf("'%s' is defined in both the '%s' and the '%s' sections", name, templatesKey, machinesKey)
+			}
+			def, ok := item.Value.(yaml.MapSlice)
+			if !ok && item.Value != nil {
+				return nil, nil, fmt.Errorf("the definition of '%s' must be a map", name)
+			}
+			defs[name] = def
+		}
+	}
+
+	r := extendsResolver{
+		defs:     defs,
+		resolved: map[string]yaml.MapSlice{},
+		parents:  extendsMap{},
+		opts:     opts,
+	}
+
+	res := yaml.MapSlice{}
+	for _, item := range tree {
+		switch item.Key {
+		case templatesKey:
+			continue
+		case machinesKey:
+			machines := yaml.MapSlice{}
+			for _, m := range sections[machinesKey] {
+				name := fmt.Sprint(m.Key)
+				def, err := r.resolve(name, nil)
+				if err != nil {
+					return nil, nil, err
+				}
+				machines = append(machines, yaml.MapItem{Key: m.Key, Value: def})
+			}
+			res = append(res, yaml.MapItem{Key: item.Key, Value: machines})
+		default:
+			res = append(res, item)
+		}
+	}
+	return res, r.parents, nil
+}
+
+// extendsMap maps machines and templates to the definitions they extend
+type extendsMap map[string][]string
+
+// ancestors returns all the definitions a definition inherits from (recursively),
+// from the lowest to the highest precedence
+func (m extendsMap) ancestors(name string) []string {
+	res := []string{}
+	for _, parent := range m[name] {
+		for _, a := range append(m.ancestors(parent), parent) {
+			// keep only the occurrence with the highest precedence
+			for i, r := range res {
+				if r == a {
+					res = append(res[:i], res[i+1:]...)
+					break
+				}
+			}
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+type extendsResolver struct {
+	defs     map[string]yaml.MapSlice
+	resolved map[string]yaml.MapSlice
+	parents  extendsMap
+	opts     MergeOptions
+}
+
+// resolve the definition of a machine, where chain is the list of children being resolved
+func (r *extendsResolver) resolve(name string, chain []string) (yaml.MapSlice, error) {
+	if def, found := r.resolved[name]; found {
+		return def, nil
+	}
+	for _, c := range chain {
+		if c == name {
+			return nil, fmt.Errorf("cycle in machines inheritance: %s", strings.Join(append(chain, name), " -> "))
+		}
+	}
+	chain = append(append([]string{}, chain...), name)
+
+	def := copyTree(r.defs[name])
+	i := treeIndex(def, extendsKey)
+	if i < 0 {
+		r.resolved[name] = def
+		return def, nil
+	}
+
+	parents, err := toStringList(def[i].Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid '%s' in '%s': %s", extendsKey, name, err)
+	}
+	def = append(def[:i:i], def[i+1:]...)
+	r.parents[name] = parents
+
+	res := yaml.MapSlice{}
+	for _, parent := range parents {
+		if _, found := r.defs[parent]; !found {
+			return nil, fmt.Errorf("'%s' extends an unknown machine or template '%s'", name, parent)
+		}
+		parentDef, err := r.resolve(parent, chain)
+		if err != nil {
+			return nil, err
+		}
+		res = MergeTrees(res, parentDef, r.opts)
+	}
+	res = MergeTrees(res, def, r.opts)
+
+	r.resolved[name] = res
+	return res, nil
+}
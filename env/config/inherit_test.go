@@ -0,0 +1,104 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+const test_config_extends = `
+driver:
+  virtualbox:
+    memory: 1024
+
+templates:
+  base:
+    instances: 1
+    engine:
+      storage-driver: overlay
+      labels: [class=base]
+    driver:
+      openstack:
+        flavor-name:  tiny
+        image-name:   Ubuntu 14.04 LTS
+
+machines:
+  worker:
+    extends: base
+    instances: 4
+    swarm:
+      discovery: token://1234
+  big-worker:
+    extends: worker
+    driver:
+      openstack:
+        flavor-name:  large
+  master:
+    extends: [worker, base]
+    swarm:
+      master: true
+  standalone:
+    instances: 1
+`
+
+func TestResolveExtends(t *testing.T) {
+	tree, err := config.ResolveExtends(parseTree(t, test_config_extends), config.MergeOptions{})
+	require.NoError(t, err)
+	cfg, err := config.NewConfigFromTree(tree)
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Machines, 4, "templates must not be instantiated")
+
+	worker := cfg.Machines["worker"]
+	require.Equal(t, "4", worker.Instances, "instances mismatch")
+	require.Equal(t, "overlay", worker.Engine.StorageDriver, "storage driver mismatch")
+	require.Equal(t, "openstack", worker.Driver.Name, "driver mismatch")
+	require.Equal(t, "token://1234", worker.Swarm.Discovery, "discovery mismatch")
+
+	bigWorker := cfg.Machines["big-worker"]
+	require.Equal(t, "4", bigWorker.Instances, "instances mismatch")
+	require.Equal(t, "large", bigWorker.Driver.Options["flavor-name"], "flavor mismatch")
+	require.Equal(t, "Ubuntu 14.04 LTS", bigWorker.Driver.Options["image-name"], "image mismatch")
+	require.Equal(t, "token://1234", bigWorker.Swarm.Discovery, "discovery mismatch")
+
+	// the last parent takes precedence
+	master := cfg.Machines["master"]
+	require.Equal(t, "1", master.Instances, "instances mismatch")
+	require.True(t, master.Swarm.Master, "swarm master mismatch")
+	require.Equal(t, "token://1234", master.Swarm.Discovery, "discovery mismatch")
+
+	standalone := cfg.Machines["standalone"]
+	require.Nil(t, standalone.Driver, "standalone must take the driver from the global section")
+}
+
+func TestResolveExtendsErrors(t *testing.T) {
+	for _, s := range []string{
+		`
+machines:
+  a:
+    extends: b
+  b:
+    extends: c
+  c:
+    extends: a
+`,
+		`
+machines:
+  a:
+    extends: unknown
+`,
+		`
+templates:
+  a:
+    instances: 1
+machines:
+  a:
+    instances: 1
+`,
+	} {
+		_, err := config.ResolveExtends(parseTree(t, s), config.MergeOptions{})
+		require.Error(t, err, "error not detected in %s", s)
+	}
+}
@@ -0,0 +1,289 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultBasename is the basename of all the configuration files
+	DefaultBasename = "docker-env"
+
+	includeKey = "include"
+	extendsKey = "extends"
+)
+
+var configExtensions = []string{".yml", ".yaml"}
+
+// Loader loads and merges configuration files
+//
+// Besides the positional "docker-env-<name>.yml" convention, any file can use
+// some directives for loading other files:
+//
+//   - "include: [path, ...]" merges the files (relative to the file that
+//     includes them, or globs) before the file itself, in the order given.
+//   - "extends: name" merges "docker-env-<name>.yml" (or "name", when it
+//     looks like a path) before the file itself and before any include.
+//
+// so the values in the including file always take precedence.
+//
+// The variables files in the "var-files" key (relative to the file that
+// declares them) are loaded after merging all the files, so they take
+// precedence over the "vars" section.
+type Loader struct {
+	Dir     string
+	Options MergeOptions
+
+	// the positions of the keys in the files loaded
+	positions positionsMap
+	// all the values in the files loaded
+	history historyMap
+}
+
+// NewLoader creates a loader for the files in a directory
+func NewLoader(dir string, opts MergeOptions) *Loader {
+	return &Loader{
+		Dir:       dir,
+		Options:   opts,
+		positions: positionsMap{},
+		history:   historyMap{},
+	}
+}
+
+// Load loads the base "docker-env.yml" and then the "docker-env-<name>.yml"
+// files for the names given, merging them in order
+func (l *Loader) Load(names []string) (*Config, error) {
+	tree, err := l.LoadTree(names)
+	if err != nil {
+		return nil, err
+	}
+	tree, extends, err := resolveExtends(tree, l.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := NewConfigFromTree(tree)
+	if err != nil {
+		// try to find a better error, with the position in the files
+		v := validator{config: &Config{tree: tree, positions: l.positions}}
+		v.validateTree(tree)
+		if len(v.errs) > 0 {
+			return nil, v.errs
+		}
+		return nil, err
+	}
+	config.positions = l.positions
+	config.history = l.history
+	config.extends = extends
+	config.environments = names
+
+	for _, filename := range config.VarFiles {
+		if err := config.LoadVarFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// LoadTree is like Load, but returns the merged tree (before resolving
+// the inheritance between machines)
+func (l *Loader) LoadTree(names []string) (yaml.MapSlice, error) {
+	tree := yaml.MapSlice{}
+	loaded := 0
+	l.positions = positionsMap{}
+	l.history = historyMap{}
+
+	filename, err := l.find(l.Dir, DefaultBasename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		log.Debug("No base config file found")
+	} else {
+		if tree, err = l.merge(tree, filename, nil); err != nil {
+			return nil, err
+		}
+		loaded++
+	}
+
+	for _, name := range names {
+		filename, err := l.find(l.Dir, fmt.Sprintf("%s-%s", DefaultBasename, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("No configuration file found for '%s'", name)
+			}
+			return nil, err
+		}
+		if tree, err = l.merge(tree, filename, nil); err != nil {
+			return nil, err
+		}
+		loaded++
+	}
+	if loaded == 0 {
+		return nil, fmt.Errorf("No configuration files found")
+	}
+
+	return tree, nil
+}
+
+// find the configuration file for a basename in a directory
+func (l *Loader) find(dir, basename string) (string, error) {
+	for _, ext := range configExtensions {
+		filename := filepath.Join(dir, basename+ext)
+		log.Debugf("Trying to load '%s'", filename)
+		if _, err := os.Stat(filename); err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+			continue
+		}
+		return filename, nil
+	}
+	return "", os.ErrNotExist
+}
+
+// load a file (and everything it includes or extends) and merge it on top of tree
+func (l *Loader) merge(tree yaml.MapSlice, filename string, chain []string) (yaml.MapSlice, error) {
+	filename, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range chain {
+		if f == filename {
+			return nil, fmt.Errorf("Include cycle detected: %s", strings.Join(append(chain, filename), " -> "))
+		}
+	}
+	chain = append(append([]string{}, chain...), filename)
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read %s%s: %s", filename, includedFrom(chain), err)
+	}
+
+	fileTree := yaml.MapSlice{}
+	if err := yaml.Unmarshal(b, &fileTree); err != nil {
+		return nil, fmt.Errorf("Parse error when reading %s%s: %s", filename, includedFrom(chain), err)
+	}
+	log.Debugf("... '%s' successfully loaded", filename)
+
+	dir := filepath.Dir(filename)
+	directives := map[string]interface{}{}
+	for _, key := range []string{extendsKey, includeKey} {
+		if i := treeIndex(fileTree, key); i >= 0 {
+			directives[key] = fileTree[i].Value
+			fileTree = append(fileTree[:i:i], fileTree[i+1:]...)
+		}
+	}
+
+	// variables files are relative to the file where they are declared
+	if i := treeIndex(fileTree, varFilesKey); i >= 0 && fileTree[i].Value != nil {
+		files, err := toStringList(fileTree[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid '%s' in %s%s: a list of paths was expected", varFilesKey, filename, includedFrom(chain))
+		}
+		paths := []interface{}{}
+		for _, f := range files {
+			paths = append(paths, resolvePath(dir, f))
+		}
+		fileTree[i].Value = paths
+	}
+
+	if v, found := directives[extendsKey]; found {
+		name, ok := v.(string)
+		if !ok || len(name) == 0 {
+			return nil, fmt.Errorf("Invalid '%s' in %s%s: a name or path was expected", extendsKey, filename, includedFrom(chain))
+		}
+		parent, err := l.findExtended(dir, name)
+		if err != nil {
+			return nil, fmt.Errorf("Could not find '%s' extended in %s%s", name, filename, includedFrom(chain))
+		}
+		if tree, err = l.merge(tree, parent, chain); err != nil {
+			return nil, err
+		}
+	}
+
+	if v, found := directives[includeKey]; found {
+		patterns, err := toStringList(v)
+		if err != nil || len(patterns) == 0 {
+			return nil, fmt.Errorf("Invalid '%s' in %s%s: a list of paths was expected", includeKey, filename, includedFrom(chain))
+		}
+		for _, pattern := range patterns {
+			included, err := l.expandInclude(dir, pattern)
+			if err != nil {
+				return nil, fmt.Errorf("Could not include '%s' in %s%s: %s", pattern, filename, includedFrom(chain), err)
+			}
+			for _, f := range included {
+				if tree, err = l.merge(tree, f, chain); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	// the positions in this file take precedence over the positions in the files it includes
+	filePositions := indexPositions(filename, b)
+	l.positions.update(filePositions)
+	l.history.record(fileTree, filePositions, "")
+
+	return MergeTrees(tree, fileTree, l.Options), nil
+}
+
+// find the file for an "extends": a path or a name like "base" for "docker-env-base.yml"
+func (l *Loader) findExtended(dir, name string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) || isConfigFilename(name) {
+		filename := resolvePath(dir, name)
+		_, err := os.Stat(filename)
+		return filename, err
+	}
+	return l.find(dir, fmt.Sprintf("%s-%s", DefaultBasename, name))
+}
+
+// get the list of files included by a pattern
+func (l *Loader) expandInclude(dir, pattern string) ([]string, error) {
+	pattern = resolvePath(dir, pattern)
+	if !strings.ContainsAny(pattern, "*?[") {
+		if _, err := os.Stat(pattern); err != nil {
+			return nil, err
+		}
+		return []string{pattern}, nil
+	}
+
+	// globs can match nothing, and they are loaded in lexical order
+	return filepath.Glob(pattern)
+}
+
+func resolvePath(dir, path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home := os.Getenv("HOME"); len(home) > 0 {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func isConfigFilename(name string) bool {
+	for _, ext := range configExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// a description of the include chain, from the innermost file to the outermost
+func includedFrom(chain []string) string {
+	res := ""
+	for i := len(chain) - 2; i >= 0; i-- {
+		res += fmt.Sprintf(", included from %s", chain[i])
+	}
+	return res
+}
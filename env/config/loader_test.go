@@ -0,0 +1,158 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+// create a directory with some files, returning the directory
+func createFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "docker-env-test")
+	require.NoError(t, err)
+
+	for name, contents := range files {
+		filename := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		require.NoError(t, ioutil.WriteFile(filename, []byte(contents), 0644))
+	}
+	return dir
+}
+
+func TestLoaderNames(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+vars:
+  NUM_WORKERS: 1
+machines:
+  worker:
+    instances: $(NUM_WORKERS)
+`,
+		"docker-env-production.yaml": `
+vars:
+  NUM_WORKERS: 10
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load([]string{"production"})
+	require.NoError(t, err)
+	require.Equal(t, "10", cfg.Vars["NUM_WORKERS"], "NUM_WORKERS mismatch")
+	require.Contains(t, cfg.Machines, "worker", "worker not found")
+
+	_, err = config.NewLoader(dir, config.MergeOptions{}).Load([]string{"unknown"})
+	require.Error(t, err, "unknown environment loaded")
+}
+
+func TestLoaderInclude(t *testing.T) {
+	shared := createFiles(t, map[string]string{
+		"drivers/openstack.yml": `
+driver:
+  openstack:
+    flavor-name:  tiny
+    image-name:   Ubuntu 14.04 LTS
+`,
+		"engine/a.yml": `
+engine:
+  storage-driver: overlay
+  labels: [a]
+`,
+		"engine/b.yml": `
+engine:
+  labels: [b]
+`,
+	})
+	defer os.RemoveAll(shared)
+
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+include:
+  - ` + filepath.Join(shared, "drivers/openstack.yml") + `
+  - ` + filepath.Join(shared, "engine/*.yml") + `
+  - ` + filepath.Join(shared, "nothing/*.yml") + `
+  - local/swarm.yml
+driver:
+  openstack:
+    flavor-name:  large
+`,
+		"local/swarm.yml": `
+swarm:
+  discovery: token://1234
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.NoError(t, err)
+
+	require.Equal(t, "openstack", cfg.Driver.Name, "driver name mismatch")
+	require.Equal(t, "large", cfg.Driver.Options["flavor-name"], "the including file must take precedence")
+	require.Equal(t, "Ubuntu 14.04 LTS", cfg.Driver.Options["image-name"], "image mismatch")
+	require.Equal(t, "overlay", cfg.Engine.StorageDriver, "storage driver mismatch")
+	require.Equal(t, []string{"b"}, cfg.Engine.Labels, "globs must be loaded in order")
+	require.Equal(t, "token://1234", cfg.Swarm.Discovery, "discovery mismatch")
+}
+
+func TestLoaderExtends(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env-base.yml": `
+vars:
+  NUM_WORKERS: 1
+  NUM_DATABASES: 1
+`,
+		"docker-env-production.yml": `
+extends: base
+vars:
+  NUM_WORKERS: 10
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load([]string{"production"})
+	require.NoError(t, err)
+	require.Equal(t, "10", cfg.Vars["NUM_WORKERS"], "NUM_WORKERS mismatch")
+	require.Equal(t, "1", cfg.Vars["NUM_DATABASES"], "NUM_DATABASES mismatch")
+}
+
+func TestLoaderErrors(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+include: [a.yml]
+`,
+		"a.yml": `
+include: [b.yml]
+`,
+		"b.yml": `
+include: [a.yml]
+`,
+		"docker-env-broken.yml": `
+include: [c.yml]
+`,
+		"c.yml": `
+vars: [
+`,
+		"docker-env-missing.yml": `
+include: [missing.yml]
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.Error(t, err, "include cycle not detected")
+	require.Contains(t, err.Error(), "cycle")
+
+	// remove the cycle
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.yml"), []byte("vars: {}"), 0644))
+
+	_, err = config.NewLoader(dir, config.MergeOptions{}).Load([]string{"broken"})
+	require.Error(t, err, "parse error not detected")
+	require.Contains(t, err.Error(), "c.yml, included from "+filepath.Join(dir, "docker-env-broken.yml"))
+
+	_, err = config.NewLoader(dir, config.MergeOptions{}).Load([]string{"missing"})
+	require.Error(t, err, "missing include not detected")
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnerror"
 	"github.com/docker/machine/libmachine/swarm"
+	"gopkg.in/yaml.v2"
 )
 
 const (
@@ -18,14 +19,54 @@ const (
 	defaultMachineMemory = 2048
 )
 
+// the keys that can be used in a machine definition
+var machineSchema = sectionSchema{
+	"instances": intValue,
+	"priority":  intValue,
+	"when":      scalarValue,
+	"for_each":  listOrMapValue,
+	"placement": mapValue,
+	"retry":     mapValue,
+	"overrides": mapValue,
+	"vars":      mapValue,
+	"auth":      mapValue,
+	"engine":    mapValue,
+	"driver":    mapValue,
+	"swarm":     mapValue,
+}
+
 // Config is a configuration for an environment
 type machineConfig struct {
-	Name      string        `yaml:"-"`
-	Instances string        `yaml:"instances,omitempty"`
-	Auth      *authConfig   `yaml:"auth,omitempty"`
-	Engine    *engineConfig `yaml:"engine,omitempty"`
-	Driver    *driverConfig `yaml:"driver,omitempty"`
-	Swarm     *swarmConfig  `yaml:"swarm,omitempty"`
+	Name      string           `yaml:"-"`
+	Instances string           `yaml:"instances,omitempty"`
+	Priority  string           `yaml:"priority,omitempty"`
+	When      string           `yaml:"when,omitempty"`
+	ForEach   forEachConfig    `yaml:"for_each,omitempty"`
+	Placement *placementConfig `yaml:"placement,omitempty"`
+	Retry     *retryConfig     `yaml:"retry,omitempty"`
+	Overrides yaml.MapSlice    `yaml:"overrides,omitempty"`
+	Vars      varsMap          `yaml:"vars,omitempty"`
+	Auth      *authConfig      `yaml:"auth,omitempty"`
+	Engine    *engineConfig    `yaml:"engine,omitempty"`
+	Driver    *driverConfig    `yaml:"driver,omitempty"`
+	Swarm     *swarmConfig     `yaml:"swarm,omitempty"`
+
+	// the conditions for the sections, as in "engine: {when: ...}"
+	Conditions map[string]string `yaml:"-"`
+
+	// the name of the definition in the "machines" section
+	definition string
+	// the values chosen for the driver options distributed by the placement policy
+	placed map[string]string
+	// the keys of the overrides applied to this instance
+	overridden []string
+	// the position of the definition in the "machines" section or, once
+	// expanded, the position of the instance in the list of machines
+	position int
+	// the (parsed) priority: machines with higher priorities go first
+	priority int
+	// the typed values that must be decoded after replacing variables
+	typed typedValues
 }
 
 func (machine machineConfig) Copy() *machineConfig {
@@ -33,9 +74,36 @@ func (machine machineConfig) Copy() *machineConfig {
 	machine.Engine = machine.Engine.Copy()
 	machine.Driver = machine.Driver.Copy()
 	machine.Swarm = machine.Swarm.Copy()
+	machine.Retry = machine.Retry.Copy()
 	return &machine
 }
 
+func (machine machineConfig) MarshalYAML() (interface{}, error) {
+	res := yaml.MapSlice{}
+	if n, err := strconv.Atoi(machine.Instances); err == nil {
+		res = append(res, yaml.MapItem{Key: "instances", Value: n})
+	} else {
+		res = append(res, yaml.MapItem{Key: "instances", Value: machine.Instances})
+	}
+	if machine.Auth != nil {
+		res = append(res, yaml.MapItem{Key: "auth", Value: machine.Auth})
+	}
+	if machine.Engine != nil {
+		res = append(res, yaml.MapItem{Key: "engine", Value: machine.Engine})
+	}
+	if machine.Driver != nil {
+		res = append(res, yaml.MapItem{Key: "driver", Value: machine.Driver})
+	}
+	// a "swarm" section enables swarm, so skip it when swarm is disabled
+	if machine.Swarm != nil && machine.Swarm.IsSwarm {
+		res = append(res, yaml.MapItem{Key: "swarm", Value: machine.Swarm})
+	}
+	if machine.Retry != nil {
+		res = append(res, yaml.MapItem{Key: retryKey, Value: machine.Retry})
+	}
+	return res, nil
+}
+
 func (machine *machineConfig) Populate(api libmachine.API, root *Config, _ *machineConfig) error {
 	// take missing sections from the global config
 	if machine.Auth == nil {
@@ -43,13 +111,17 @@ func (machine *machineConfig) Populate(api libmachine.API, root *Config, _ *mach
 	}
 	if machine.Engine == nil {
 		machine.Engine = root.Engine.Copy()
+		machine.typed = append(machine.typed, root.typed.sections("engine")...)
 	}
 	if machine.Driver == nil {
 		machine.Driver = root.Driver.Copy()
+		machine.typed = append(machine.typed, root.typed.sections("driver")...)
 	}
 	if machine.Swarm == nil {
 		machine.Swarm = root.Swarm.Copy()
+		machine.typed = append(machine.typed, root.typed.sections("swarm")...)
 	}
+	machine.Retry = machine.Retry.inherit(root.Retry)
 
 	// populate the sections
 	for _, p := range []Populater{machine.Auth, machine.Engine, machine.Driver, machine.Swarm} {
@@ -61,6 +133,27 @@ func (machine *machineConfig) Populate(api libmachine.API, root *Config, _ *mach
 	return nil
 }
 
+// get an instance of a (populated) machine, replacing the variables for the
+// instance, like $(#), and the variables in the sections taken from the global config
+func (machine *machineConfig) instance(vars map[string]string) (*machineConfig, error) {
+	replaced, err := replaceAllVars(machine.Copy(), vars)
+	if err != nil {
+		return nil, err
+	}
+	instance, ok := replaced.(*machineConfig)
+	if !ok {
+		return nil, fmt.Errorf("could not replace variables in machine '%s'", machine.Name)
+	}
+	instance.Instances = "1"
+	instance.ForEach = nil
+	instance.Placement = nil
+	instance.Overrides = nil
+	instance.definition = machine.definition
+	instance.priority = machine.priority
+	instance.typed = machine.typed
+	return instance, nil
+}
+
 func (machine *machineConfig) NewHost(api libmachine.API) (*host.Host, error) {
 	driver, err := machine.Driver.Get(api)
 	if err != nil {
@@ -108,77 +201,168 @@ func (machine *machineConfig) LoadHost(api libmachine.API) (*host.Host, error) {
 
 type machineConfigMap map[string]*machineConfig
 
+// Populate expands all the machine definitions (in the order they were declared)
+// into the final list of machines, replacing the definitions in the map
 func (m machineConfigMap) Populate(api libmachine.API, root *Config, _ *machineConfig) error {
-	for name, machine := range m {
-		// fix the name
-		machine.Name = name
-
-		// replace all the vars
-		machine, ok := ReplaceAllStringMap(machine, map[string]string(root.Vars)).(*machineConfig)
-		if !ok {
-			panic("could not cast to machineConfig")
-		}
+	return m.populate(api, root, &validator{config: root})
+}
 
-		// populate the machine
-		if err := machine.Populate(api, root, machine); err != nil {
+// populate the machines, reporting the references to undefined variables
+// to the undefined validator (and checking them at the end)
+func (m machineConfigMap) populate(api libmachine.API, root *Config, undefined *validator) error {
+	expanded := machineConfigMap{}
+	for _, machine := range m.definitions() {
+		instances, err := machine.expand(api, root, undefined)
+		if err != nil {
 			return err
 		}
-
-		// check if there are multiple instances of the machine...
-		numInstances, err := strconv.Atoi(machine.Instances)
-		if err != nil {
-			if hasVars(machine.Instances) {
-				return fmt.Errorf("undefined variable(s) in the instances number, '%s'", machine.Instances)
+		for _, instance := range instances {
+			if _, found := expanded[instance.Name]; found {
+				return root.errorAt(keysPath(machinesKey, instance.definition), machine.Name, "duplicate machine name '%s'", instance.Name)
 			}
-			return fmt.Errorf("cannot parse the number of instances from '%s'", machine.Instances)
+			instance.position = len(expanded)
+			expanded[instance.Name] = instance
 		}
+	}
 
-		if numInstances == 0 {
-			delete(m, name)
-		} else if numInstances > 1 {
-			if !hasVar(machine.Name, "#") {
-				machine.Name = fmt.Sprintf("%s-$(#)", machine.Name)
-			}
+	for name := range m {
+		delete(m, name)
+	}
+	for name, machine := range expanded {
+		m[name] = machine
+	}
 
-			// create the additional machines
-			for i := 2; i <= numInstances; i++ {
-				additionalMachine := machine.Copy()
-				newName, err := replaceVars(machine.Name, map[string]string{"#": strconv.Itoa(i)})
-				if err != nil {
-					return fmt.Errorf("could not replace the $(#) variable in '%s': %s", additionalMachine.Name, err)
-				}
-				additionalMachine.Name = newName
-				additionalMachine.Instances = "1"
+	// fail before doing anything with hosts if some variables are not defined
+	return undefined.checkUndefinedVars()
+}
 
-				// populate the new machine
-				if err := additionalMachine.Populate(api, root, machine); err != nil {
-					return err
-				}
+// expand a machine definition into its (populated) instances, in order,
+// checking the references to undefined variables in them
+func (machine *machineConfig) expand(api libmachine.API, root *Config, undefined *validator) ([]*machineConfig, error) {
+	name := machine.Name
+	definition := machine.definition
+	if len(definition) == 0 {
+		definition = name
+	}
 
-				m[additionalMachine.Name] = additionalMachine
-			}
+	// replace all the vars, with the machine variables shadowing the global ones
+	machine.definition = definition
+	vars, err := root.resolveVars(machine, undefined)
+	if err != nil {
+		return nil, err
+	}
+	typed := machine.typed
+	replaced, err := replaceAllVars(machine, vars)
+	if err != nil {
+		return nil, root.errorAt(keysPath(machinesKey, definition), name, "%s", err)
+	}
+	machine, ok := replaced.(*machineConfig)
+	if !ok {
+		return nil, fmt.Errorf("could not replace variables in machine '%s'", name)
+	}
+	machine.definition = definition
+	machine.typed = typed
+
+	// skip the machine (or some sections) when the conditions are false
+	keep, err := machine.evalConditions(root)
+	if err != nil {
+		return nil, err
+	}
+	if !keep {
+		return nil, nil
+	}
+	if err := machine.parsePriority(); err != nil {
+		return nil, root.errorAt(keysPath(machinesKey, definition, priorityKey), name, "%s", err)
+	}
+
+	// populate the machine
+	if err := machine.Populate(api, root, machine); err != nil {
+		return nil, err
+	}
+
+	// check if there are multiple instances of the machine...
+	instancesPath := keysPath(machinesKey, definition, "instances")
+	if len(machine.Instances) == 0 {
+		machine.Instances = "1"
+	}
+	numInstances, err := strconv.Atoi(machine.Instances)
+	if err != nil {
+		if hasVars(machine.Instances) {
+			return nil, root.errorAt(instancesPath, "", "undefined variable(s) in the instances number, '%s'", machine.Instances)
+		}
+		return nil, root.errorAt(instancesPath, "", "cannot parse the number of instances from '%s'", machine.Instances)
+	}
+	if numInstances < 0 {
+		return nil, root.errorAt(instancesPath, "", "invalid number of instances, %d", numInstances)
+	}
 
-			newName, err := replaceVars(machine.Name, map[string]string{"#": "1"})
+	if numInstances == 0 {
+		return nil, nil
+	}
+	forEach, err := machine.ForEach.expand()
+	if err != nil {
+		return nil, root.errorAt(keysPath(machinesKey, definition, forEachKey), name, "%s", err)
+	}
+	if len(forEach) > 0 && !hasVarsMatching(machine.Name, isEachVar) {
+		machine.Name += forEach.nameSuffix()
+	}
+	if numInstances > 1 && !hasVarsMatching(machine.Name, isIndexVar) {
+		machine.Name = fmt.Sprintf("%s-$(#)", machine.Name)
+	}
+
+	// we will return "machine-1", "machine-2"... instead of "machine"
+	res := []*machineConfig{}
+	overridden := map[string]bool{}
+	// the index of the instance in all the combinations, for the overrides
+	index := 0
+	for _, each := range forEach.combinations() {
+		placed, err := machine.Placement.place(definition, each, machine.Driver.Options, numInstances)
+		if err != nil {
+			return nil, root.errorAt(keysPath(machinesKey, definition, placementKey), name, "%s", err)
+		}
+
+		for i := 1; i <= numInstances; i++ {
+			ivars := instanceVars(vars, i, numInstances, each)
+			instance, err := machine.instance(ivars)
 			if err != nil {
-				return fmt.Errorf("could not replace some vars in '%s': %s", machine.Name, err)
+				return nil, root.errorAt(keysPath(machinesKey, definition), name, "%s", err)
+			}
+			for option, value := range placed[i-1] {
+				instance.Driver.Options[option] = value
+			}
+			instance.placed = placed[i-1]
+
+			index++
+			if instance.overridden, err = instance.applyOverrides(machine.Overrides, index); err != nil {
+				return nil, root.errorAt(keysPath(machinesKey, definition, overridesKey), name, "%s", err)
+			}
+			for _, key := range instance.overridden {
+				overridden[key] = true
+			}
+			if err := instance.applyTyped(root, ivars, undefined); err != nil {
+				return nil, err
 			}
-			machine.Name = newName
-			machine.Instances = "1"
-
-			// we have inserted "machine-1", "machine-2"..., so remove the old "machine"
-			delete(m, name)
-			m[machine.Name] = machine
-		} else {
-			// update the machine with the populated version
-			m[machine.Name] = machine
+
+			// populate the new machine
+			if err := instance.Populate(api, root, machine); err != nil {
+				return nil, err
+			}
+			undefined.validateUndefinedVars(instance, ivars)
+			res = append(res, instance)
 		}
 	}
-	return nil
+
+	for _, item := range machine.Overrides {
+		if key := fmt.Sprint(item.Key); !overridden[key] {
+			return nil, root.errorAt(keysPath(machinesKey, definition, overridesKey, key), name, "the override '%s' does not match any instance", key)
+		}
+	}
+	return res, nil
 }
 
 func (m machineConfigMap) NewHosts(api libmachine.API) ([]*host.Host, error) {
 	res := []*host.Host{}
-	for _, machine := range m {
+	for _, machine := range m.Ordered() {
 		host, err := machine.NewHost(api)
 		if err != nil {
 			return nil, err
@@ -191,7 +375,7 @@ func (m machineConfigMap) NewHosts(api libmachine.API) ([]*host.Host, error) {
 // Load all the existing hosts
 func (m machineConfigMap) LoadExistingHosts(api libmachine.API, f func(string)) ([]*host.Host, error) {
 	res := []*host.Host{}
-	for _, machine := range m {
+	for _, machine := range m.Ordered() {
 		host, err := machine.LoadHost(api)
 		if err != nil {
 			switch err := err.(type) {
@@ -207,6 +391,28 @@ func (m machineConfigMap) LoadExistingHosts(api libmachine.API, f func(string))
 	return res, nil
 }
 
+// Load all the existing hosts, and get new hosts (not created yet) for the
+// machines that do not exist, calling f with their names
+func (m machineConfigMap) LoadOrNewHosts(api libmachine.API, f func(string)) ([]*host.Host, error) {
+	res := []*host.Host{}
+	for _, machine := range m.Ordered() {
+		host, err := machine.LoadHost(api)
+		if err != nil {
+			switch err.(type) {
+			case mcnerror.ErrHostDoesNotExist:
+				if host, err = machine.NewHost(api); err != nil {
+					return nil, err
+				}
+				f(machine.Name)
+			default:
+				return nil, err
+			}
+		}
+		res = append(res, host)
+	}
+	return res, nil
+}
+
 // Load all the hosts (they must exist in the store)
 func (m machineConfigMap) LoadHosts(api libmachine.API) ([]*host.Host, error) {
 	notFound := 0
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Configuration files are merged in the order they are loaded, so values
+// in a file take precedence over the values in all the files loaded before:
+//
+//   docker-env.yml < docker-env-<name1>.yml < docker-env-<name2>.yml < ... < -X vars
+//
+// The merge is done at the key level:
+//
+//   * maps (the "vars", "auth", "engine" and "swarm" sections, the driver
+//     options and the "machines" section) are merged key by key, recursively,
+//     so machines with the same name are merged together.
+//   * scalars in the overlay replace the values in the base.
+//   * lists are replaced or appended depending on the MergeOptions.
+//   * a "driver" section holds just one driver, so its options are merged when
+//     both files use the same driver, and it is replaced otherwise.
+//   * empty values (like in "virtualbox:") do not remove anything from the base.
+
+// ListsMerge is the strategy used for merging lists
+type ListsMerge int
+
+const (
+	// ListsReplace replaces the lists in the base by the lists in the overlay
+	ListsReplace ListsMerge = iota
+	// ListsAppend appends the elements in the overlay that are not in the base
+	ListsAppend
+)
+
+var listsMergeNames = map[string]ListsMerge{
+	"replace": ListsReplace,
+	"append":  ListsAppend,
+}
+
+// ParseListsMerge parses a lists merge strategy name
+func ParseListsMerge(s string) (ListsMerge, error) {
+	if s == "" {
+		return ListsReplace, nil
+	}
+	if lm, found := listsMergeNames[s]; found {
+		return lm, nil
+	}
+	return ListsReplace, fmt.Errorf("unknown lists merge strategy '%s'", s)
+}
+
+// MergeOptions are the options used when merging configuration trees
+type MergeOptions struct {
+	Lists ListsMerge
+}
+
+// MergeTrees merges the overlay tree on top of the base tree, returning a new tree
+func MergeTrees(base, overlay yaml.MapSlice, opts MergeOptions) yaml.MapSlice {
+	return mergeMaps(base, overlay, []string{}, opts)
+}
+
+// NewConfigFromTree decodes a (probably merged) configuration tree
+func NewConfigFromTree(tree yaml.MapSlice) (*Config, error) {
+	b, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	config := &Config{}
+	if err := yaml.Unmarshal(b, config); err != nil {
+		return nil, err
+	}
+	config.tree = tree
+	return config, nil
+}
+
+func mergeMaps(base, overlay yaml.MapSlice, path []string, opts MergeOptions) yaml.MapSlice {
+	res := copyTree(base)
+	for _, item := range overlay {
+		i := treeIndex(res, item.Key)
+		if i < 0 {
+			res = append(res, yaml.MapItem{Key: item.Key, Value: copyTreeValue(item.Value)})
+			continue
+		}
+		itemPath := append(append([]string{}, path...), fmt.Sprint(item.Key))
+		res[i].Value = mergeValues(res[i].Value, item.Value, itemPath, opts)
+	}
+	return res
+}
+
+func mergeValues(base, overlay interface{}, path []string, opts MergeOptions) interface{} {
+	if overlay == nil {
+		return base
+	}
+
+	switch o := overlay.(type) {
+	case yaml.MapSlice:
+		b, ok := base.(yaml.MapSlice)
+		if !ok {
+			return copyTree(o)
+		}
+		if isDriverPath(path) && !sameKeys(b, o) {
+			return copyTree(o)
+		}
+		return mergeMaps(b, o, path, opts)
+
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok || opts.Lists == ListsReplace {
+			return copyTreeValue(o)
+		}
+		res := copyTreeValue(b).([]interface{})
+		for _, v := range o {
+			if !listContains(res, v) {
+				res = append(res, copyTreeValue(v))
+			}
+		}
+		return res
+
+	default:
+		return o
+	}
+}
+
+// check if a path points to a "driver" section (global or in a machine)
+func isDriverPath(path []string) bool {
+	switch len(path) {
+	case 1:
+		return path[0] == "driver"
+	case 3:
+		return path[0] == "machines" && path[2] == "driver"
+	}
+	return false
+}
+
+func sameKeys(a, b yaml.MapSlice) bool {
+	// conditions are not a key like the others
+	withoutWhen := func(m yaml.MapSlice) yaml.MapSlice {
+		if i := treeIndex(m, whenKey); i >= 0 {
+			return append(m[:i:i], m[i+1:]...)
+		}
+		return m
+	}
+	a, b = withoutWhen(a), withoutWhen(b)
+
+	if len(a) != len(b) {
+		return false
+	}
+	for _, item := range b {
+		if treeIndex(a, item.Key) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func treeIndex(tree yaml.MapSlice, key interface{}) int {
+	for i, item := range tree {
+		if item.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// get the value at some path in a tree
+func treeLookup(tree yaml.MapSlice, keys ...string) (interface{}, bool) {
+	var cur interface{} = tree
+	for _, key := range keys {
+		m, ok := cur.(yaml.MapSlice)
+		if !ok {
+			return nil, false
+		}
+		found := false
+		for _, item := range m {
+			if fmt.Sprint(item.Key) == key {
+				cur, found = item.Value, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// get the map for a key in a tree
+func treeMap(tree yaml.MapSlice, key string) (yaml.MapSlice, bool) {
+	v, found := treeLookup(tree, key)
+	if !found {
+		return nil, false
+	}
+	m, ok := v.(yaml.MapSlice)
+	return m, ok
+}
+
+func listContains(lst []interface{}, v interface{}) bool {
+	for _, e := range lst {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyTree(tree yaml.MapSlice) yaml.MapSlice {
+	if tree == nil {
+		return yaml.MapSlice{}
+	}
+	res := make(yaml.MapSlice, len(tree))
+	for i, item := range tree {
+		res[i] = yaml.MapItem{Key: item.Key, Value: copyTreeValue(item.Value)}
+	}
+	return res
+}
+
+func copyTreeValue(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case yaml.MapSlice:
+		return copyTree(vv)
+	case []interface{}:
+		res := make([]interface{}, len(vv))
+		for i, e := range vv {
+			res[i] = copyTreeValue(e)
+		}
+		return res
+	default:
+		return v
+	}
+}
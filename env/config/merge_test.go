@@ -0,0 +1,185 @@
+package config_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+const test_merge_base = `
+vars:
+  NUM_DATABASES: 1
+  NUM_WORKERS:   10
+
+auth:
+  cert-dir:     /my/certs
+  tls-ca-cert:  /my/ca.pem
+
+engine:
+  storage-driver: overlay
+  labels:         [zone=a, class=base]
+
+driver:
+  openstack:
+    flavor-name:        tiny
+    image-name:         Ubuntu 14.04 LTS
+
+swarm:
+  strategy:  spread
+  discovery: token://1234
+
+machines:
+  master:
+    instances: 1
+    engine:
+      labels:    [role=master]
+    swarm:
+      master:    true
+  worker:
+    instances: $(NUM_WORKERS)
+`
+
+const test_merge_overlay = `
+vars:
+  NUM_WORKERS:   3
+
+auth:
+  tls-ca-cert:  /other/ca.pem
+
+engine:
+  labels:       [class=production]
+
+driver:
+  openstack:
+    flavor-name:        large
+
+swarm:
+  discovery: token://9999
+
+machines:
+  master:
+    engine:
+      log-level: debug
+  database:
+    instances: 2
+`
+
+func parseTree(t *testing.T, s string) yaml.MapSlice {
+	tree := yaml.MapSlice{}
+	err := yaml.Unmarshal(bytes.NewBufferString(s).Bytes(), &tree)
+	require.NoError(t, err, "tree parsing error")
+	return tree
+}
+
+func mergeConfigs(t *testing.T, opts config.MergeOptions, s ...string) *config.Config {
+	tree := yaml.MapSlice{}
+	for _, c := range s {
+		tree = config.MergeTrees(tree, parseTree(t, c), opts)
+	}
+	cfg, err := config.NewConfigFromTree(tree)
+	require.NoError(t, err, "config decoding error")
+	return cfg
+}
+
+func TestMergeVars(t *testing.T) {
+	cfg := mergeConfigs(t, config.MergeOptions{}, test_merge_base, test_merge_overlay)
+
+	require.Equal(t, "1", cfg.Vars["NUM_DATABASES"], "NUM_DATABASES mismatch")
+	require.Equal(t, "3", cfg.Vars["NUM_WORKERS"], "NUM_WORKERS mismatch")
+}
+
+func TestMergeAuth(t *testing.T) {
+	cfg := mergeConfigs(t, config.MergeOptions{}, test_merge_base, test_merge_overlay)
+
+	require.Equal(t, "/my/certs", cfg.Auth.CertDir, "cert dir mismatch")
+	require.Equal(t, "/other/ca.pem", cfg.Auth.CaCertPath, "CA cert mismatch")
+}
+
+func TestMergeEngine(t *testing.T) {
+	cfg := mergeConfigs(t, config.MergeOptions{}, test_merge_base, test_merge_overlay)
+
+	require.Equal(t, "overlay", cfg.Engine.StorageDriver, "storage driver mismatch")
+	require.Equal(t, []string{"class=production"}, cfg.Engine.Labels, "labels mismatch")
+
+	cfg = mergeConfigs(t, config.MergeOptions{Lists: config.ListsAppend},
+		test_merge_base, test_merge_overlay, test_merge_overlay)
+
+	require.Equal(t, "overlay", cfg.Engine.StorageDriver, "storage driver mismatch")
+	require.Equal(t, []string{"zone=a", "class=base", "class=production"}, cfg.Engine.Labels, "labels mismatch")
+}
+
+func TestMergeDriver(t *testing.T) {
+	cfg := mergeConfigs(t, config.MergeOptions{}, test_merge_base, test_merge_overlay)
+
+	require.Equal(t, "openstack", cfg.Driver.Name, "driver name mismatch")
+	require.Equal(t, "large", cfg.Driver.Options["flavor-name"], "flavor mismatch")
+	require.Equal(t, "Ubuntu 14.04 LTS", cfg.Driver.Options["image-name"], "image mismatch")
+
+	const test_merge_other_driver = `
+driver:
+  virtualbox:
+    memory: 1024
+`
+	cfg = mergeConfigs(t, config.MergeOptions{}, test_merge_base, test_merge_other_driver)
+
+	require.Equal(t, "virtualbox", cfg.Driver.Name, "driver name mismatch")
+	require.Len(t, cfg.Driver.Options, 1, "driver options from another driver")
+
+	const test_merge_empty_driver = `
+driver:
+  openstack:
+`
+	cfg = mergeConfigs(t, config.MergeOptions{}, test_merge_base, test_merge_empty_driver)
+
+	require.Equal(t, "openstack", cfg.Driver.Name, "driver name mismatch")
+	require.Equal(t, "tiny", cfg.Driver.Options["flavor-name"], "flavor mismatch")
+}
+
+func TestMergeSwarm(t *testing.T) {
+	cfg := mergeConfigs(t, config.MergeOptions{}, test_merge_base, test_merge_overlay)
+
+	require.Equal(t, "spread", cfg.Swarm.Strategy, "strategy mismatch")
+	require.Equal(t, "token://9999", cfg.Swarm.Discovery, "discovery mismatch")
+}
+
+func TestMergeMachines(t *testing.T) {
+	cfg := mergeConfigs(t, config.MergeOptions{}, test_merge_base, test_merge_overlay)
+
+	require.Len(t, cfg.Machines, 3, "wrong number of machines")
+
+	master := cfg.Machines["master"]
+	require.NotNil(t, master, "master not found")
+	require.Equal(t, "1", master.Instances, "instances mismatch")
+	require.True(t, master.Swarm.Master, "master has lost the swarm section")
+	require.Equal(t, []string{"role=master"}, master.Engine.Labels, "labels mismatch")
+	require.Equal(t, "debug", master.Engine.LogLevel, "log level mismatch")
+
+	require.Equal(t, "$(NUM_WORKERS)", cfg.Machines["worker"].Instances, "instances mismatch")
+	require.Equal(t, "2", cfg.Machines["database"].Instances, "instances mismatch")
+}
+
+func TestMergeDoesNotModifyInputs(t *testing.T) {
+	base := parseTree(t, test_merge_base)
+	overlay := parseTree(t, test_merge_overlay)
+	config.MergeTrees(base, overlay, config.MergeOptions{Lists: config.ListsAppend})
+
+	require.Equal(t, parseTree(t, test_merge_base), base, "base tree modified")
+	require.Equal(t, parseTree(t, test_merge_overlay), overlay, "overlay tree modified")
+}
+
+func TestParseListsMerge(t *testing.T) {
+	lm, err := config.ParseListsMerge("append")
+	require.NoError(t, err)
+	require.Equal(t, config.ListsAppend, lm)
+
+	lm, err = config.ParseListsMerge("")
+	require.NoError(t, err)
+	require.Equal(t, config.ListsReplace, lm)
+
+	_, err = config.ParseListsMerge("whatever")
+	require.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+const priorityKey = "priority"
+
+// UnmarshalYAML decodes the machines, remembering the order they were declared in
+func (m *machineConfigMap) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	tree := yaml.MapSlice{}
+	if err := unmarshal(&tree); err != nil {
+		return err
+	}
+	machines := map[string]*machineConfig{}
+	if err := unmarshal(&machines); err != nil {
+		return err
+	}
+
+	// machines decoded in a previous document are kept, and the new ones go after them
+	if *m == nil {
+		*m = machineConfigMap{}
+	}
+	for _, item := range tree {
+		name := fmt.Sprint(item.Key)
+		machine, found := machines[name]
+		if !found || machine == nil {
+			continue
+		}
+		if previous, found := (*m)[name]; found {
+			machine.position = previous.position
+		} else {
+			machine.position = len(*m)
+		}
+		(*m)[name] = machine
+	}
+	return nil
+}
+
+// Ordered returns the machines in the order they must be processed: by
+// priority (higher first), then in the order they were declared and, for
+// the instances of the same definition, in the order they were expanded
+func (m machineConfigMap) Ordered() []*machineConfig {
+	res := make([]*machineConfig, 0, len(m))
+	for _, machine := range m {
+		res = append(res, machine)
+	}
+	sort.Sort(byOrder(res))
+	return res
+}
+
+// Names returns the names of the machines, in the order they must be processed
+func (m machineConfigMap) Names() []string {
+	res := []string{}
+	for _, machine := range m.Ordered() {
+		res = append(res, machine.Name)
+	}
+	return res
+}
+
+// PriorityOf returns the priority of a machine (0 for unknown machines)
+func (m machineConfigMap) PriorityOf(name string) int {
+	if machine, found := m[name]; found {
+		return machine.priority
+	}
+	return 0
+}
+
+// get the machine definitions in the order they were declared
+func (m machineConfigMap) definitions() []*machineConfig {
+	res := []*machineConfig{}
+	for name, machine := range m {
+		// fix the name
+		machine.Name = name
+		res = append(res, machine)
+	}
+	sort.Sort(byPosition(res))
+	return res
+}
+
+// parse the priority of a machine (after replacing the variables)
+func (machine *machineConfig) parsePriority() error {
+	machine.priority = 0
+	if len(machine.Priority) == 0 {
+		return nil
+	}
+	priority, err := strconv.Atoi(machine.Priority)
+	if err != nil {
+		return fmt.Errorf("cannot parse the priority from '%s'", machine.Priority)
+	}
+	machine.priority = priority
+	return nil
+}
+
+// byPosition sorts machines by the position they were declared or expanded in
+type byPosition []*machineConfig
+
+func (a byPosition) Len() int      { return len(a) }
+func (a byPosition) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byPosition) Less(i, j int) bool {
+	if a[i].position != a[j].position {
+		return a[i].position < a[j].position
+	}
+	return a[i].Name < a[j].Name
+}
+
+// byOrder sorts machines by priority and then by position
+type byOrder []*machineConfig
+
+func (a byOrder) Len() int      { return len(a) }
+func (a byOrder) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byOrder) Less(i, j int) bool {
+	if a[i].priority != a[j].priority {
+		return a[i].priority > a[j].priority
+	}
+	return byPosition(a).Less(i, j)
+}
@@ -0,0 +1,65 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPopulateOrder(t *testing.T) {
+	const test_config_order = `
+vars:
+  db_priority: 10
+machines:
+  worker:
+    instances: 3
+    for_each:
+      zone: [b, a]
+  master:
+    instances: 1
+  zz-db:
+    instances: 1
+    priority: $(db_priority)
+  aa-proxy:
+    instances: 1
+    priority: -1
+`
+
+	expected := []string{
+		"zz-db",
+		"worker-b-1", "worker-b-2", "worker-b-3",
+		"worker-a-1", "worker-a-2", "worker-a-3",
+		"master",
+		"aa-proxy",
+	}
+
+	// the order must not depend on the iteration order of the maps
+	for i := 0; i < 10; i++ {
+		cfg := config.Config{}
+		err := yaml.Unmarshal([]byte(test_config_order), &cfg)
+		require.NoError(t, err, "config parsing error")
+		require.NoError(t, cfg.Populate(nil, nil, nil))
+
+		require.Equal(t, expected, cfg.Machines.Names(), "wrong order of machines")
+
+		tree, err := cfg.ResolvedTree("")
+		require.NoError(t, err)
+		machines := tree[0].Value.(yaml.MapSlice)
+		require.Len(t, machines, len(expected))
+		for j, item := range machines {
+			require.Equal(t, expected[j], item.Key, "wrong order in the rendered configuration")
+		}
+	}
+}
+
+func TestPopulateOrderInvalidPriority(t *testing.T) {
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte("machines: {master: {instances: 1, priority: high}}"), &cfg)
+	require.NoError(t, err, "config parsing error")
+	err = cfg.Populate(nil, nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot parse the priority from 'high'")
+}
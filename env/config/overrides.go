@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+const overridesKey = "overrides"
+
+// the keys that can be used in an override
+var overrideSchema = sectionSchema{
+	"auth":   mapValue,
+	"engine": mapValue,
+	"driver": mapValue,
+	"swarm":  mapValue,
+}
+
+// apply the overrides for an instance of a machine, where overrides are
+// keyed by the instance number (starting at 1, and counting the instances
+// of all the "for_each" combinations) or by the instance name, like
+//
+//	overrides:
+//	  1:
+//	    swarm:
+//	      master: true
+//	  worker-3:
+//	    driver:
+//	      openstack:
+//	        flavor-name: large
+//
+// Overrides are merged (key by key) over the instance configuration, in the
+// order they are found. It returns the keys of the overrides applied.
+func (machine *machineConfig) applyOverrides(overrides yaml.MapSlice, index int) ([]string, error) {
+	applied := []string{}
+	tree := yaml.MapSlice{}
+	for _, item := range overrides {
+		key := fmt.Sprint(item.Key)
+		if key != strconv.Itoa(index) && key != machine.Name {
+			continue
+		}
+		override, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, fmt.Errorf("the override for '%s' must be a map", key)
+		}
+		if len(applied) == 0 {
+			var err error
+			if tree, err = normalizeTree(machine); err != nil {
+				return nil, err
+			}
+		}
+		tree = MergeTrees(tree, override, MergeOptions{})
+		machine.typed = machine.typed.drop(override)
+		applied = append(applied, key)
+	}
+	if len(applied) == 0 {
+		return nil, nil
+	}
+
+	b, err := yaml.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	overridden := machineConfig{}
+	if err := yaml.Unmarshal(b, &overridden); err != nil {
+		return nil, fmt.Errorf("invalid override for '%s': %s", machine.Name, err)
+	}
+	if overridden.Auth != nil {
+		machine.Auth = overridden.Auth
+	}
+	if overridden.Engine != nil {
+		machine.Engine = overridden.Engine
+	}
+	if overridden.Driver != nil {
+		machine.Driver = overridden.Driver
+	}
+	if overridden.Swarm != nil {
+		machine.Swarm = overridden.Swarm
+	}
+	machine.typed = append(machine.typed, overridden.typed...)
+	return applied, nil
+}
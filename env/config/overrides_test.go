@@ -0,0 +1,99 @@
+package config_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPopulateOverrides(t *testing.T) {
+	const test_config_overrides = `
+swarm:
+  discovery: token://1234
+machines:
+  worker:
+    instances: 3
+    driver:
+      openstack:
+        flavor-name: tiny
+        image-name:  Ubuntu 14.04 LTS
+    overrides:
+      1:
+        swarm:
+          master: true
+      worker-3:
+        driver:
+          openstack:
+            flavor-name: large
+`
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_overrides), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 3, "wrong number of machines")
+	require.True(t, cfg.Machines["worker-1"].Swarm.Master, "worker-1 must be the swarm master")
+	require.Equal(t, "token://1234", cfg.Machines["worker-1"].Swarm.Discovery, "discovery mismatch")
+	require.False(t, cfg.Machines["worker-2"].Swarm.Master, "worker-2 must not be the swarm master")
+
+	require.Equal(t, "large", cfg.Machines["worker-3"].Driver.Options["flavor-name"], "flavor mismatch")
+	require.Equal(t, "Ubuntu 14.04 LTS", cfg.Machines["worker-3"].Driver.Options["image-name"], "image mismatch")
+	require.Equal(t, "tiny", cfg.Machines["worker-2"].Driver.Options["flavor-name"], "flavor mismatch")
+}
+
+func TestPopulateOverridesForEach(t *testing.T) {
+	// the instances are numbered in all the combinations
+	const test_config_overrides_for_each = `
+machines:
+  worker:
+    instances: 2
+    for_each:
+      zone: [a, b]
+    overrides:
+      1:
+        swarm:
+          master: true
+      3:
+        swarm:
+          discovery: token://5678
+`
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_overrides_for_each), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 4, "wrong number of machines")
+	require.True(t, cfg.Machines["worker-a-1"].Swarm.Master, "worker-a-1 must be the swarm master")
+	for _, name := range []string{"worker-a-2", "worker-b-1", "worker-b-2"} {
+		require.False(t, cfg.Machines[name].Swarm.Master, "%s must not be the swarm master", name)
+	}
+	require.Equal(t, "token://5678", cfg.Machines["worker-b-1"].Swarm.Discovery, "discovery mismatch")
+	require.Equal(t, "", cfg.Machines["worker-a-1"].Swarm.Discovery, "discovery mismatch")
+}
+
+func TestPopulateOverridesErrors(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+machines:
+  worker:
+    instances: 2
+    overrides:
+      worker-5:
+        swarm:
+          master: true
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.NoError(t, err)
+	err = cfg.Populate(nil, nil, nil)
+	require.Error(t, err, "unknown override not detected")
+	require.Contains(t, err.Error(), "docker-env.yml:6")
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const placementKey = "placement"
+
+// PlacementPolicy is the way the instances of a machine are distributed
+// over the values of list-valued driver options, like regions or zones
+type PlacementPolicy string
+
+const (
+	// PlacementRoundRobin assigns the values in order, starting again at the first one
+	PlacementRoundRobin PlacementPolicy = "round-robin"
+	// PlacementFillFirst assigns a value to "capacity" instances before moving to the next one
+	PlacementFillFirst PlacementPolicy = "fill-first"
+	// PlacementRandom assigns random values, with a seed so the result is always the same
+	PlacementRandom PlacementPolicy = "random"
+)
+
+// the keys that can be used in a "placement" section
+var placementSchema = sectionSchema{
+	"policy":   scalarValue,
+	"options":  listValue,
+	"capacity": intValue,
+	"seed":     intValue,
+}
+
+// placementConfig is the "placement" section in a machine definition, like
+//
+//	placement:
+//	  policy:   round-robin
+//	  options:  [region]
+//
+// When no options are given, all the list-valued driver options are distributed.
+type placementConfig struct {
+	Policy string `yaml:"policy,omitempty"`
+	// the driver options distributed
+	Options []string `yaml:"options,omitempty"`
+	// the number of instances for every value, for "fill-first"
+	Capacity string `yaml:"capacity,omitempty"`
+	// the seed for "random"
+	Seed string `yaml:"seed,omitempty"`
+}
+
+// place gets the values of the distributed driver options for every instance of
+// a machine, for one combination of the "for_each" values
+func (p *placementConfig) place(definition string, each map[string]string, options driverOptions, count int) ([]map[string]string, error) {
+	res := make([]map[string]string, count)
+	for i := range res {
+		res[i] = map[string]string{}
+	}
+	if p == nil || count == 0 {
+		return res, nil
+	}
+
+	names := p.Options
+	if len(names) == 0 {
+		for name, value := range options {
+			if _, isList := value.([]interface{}); isList {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var rnd *rand.Rand
+	switch PlacementPolicy(p.Policy) {
+	case PlacementRoundRobin, PlacementFillFirst:
+	case PlacementRandom:
+		seed, err := p.seed(definition, each)
+		if err != nil {
+			return nil, err
+		}
+		rnd = rand.New(rand.NewSource(seed))
+	default:
+		return nil, fmt.Errorf("unknown placement policy '%s' (valid policies: %s, %s, %s)",
+			p.Policy, PlacementRoundRobin, PlacementFillFirst, PlacementRandom)
+	}
+
+	for _, name := range names {
+		values := options.StringSlice(name)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("no values for the driver option '%s'", name)
+		}
+
+		capacity := (count + len(values) - 1) / len(values)
+		if len(p.Capacity) > 0 {
+			var err error
+			if capacity, err = strconv.Atoi(p.Capacity); err != nil || capacity <= 0 {
+				return nil, fmt.Errorf("invalid placement capacity '%s'", p.Capacity)
+			}
+		}
+
+		for i := 0; i < count; i++ {
+			var index int
+			switch PlacementPolicy(p.Policy) {
+			case PlacementRoundRobin:
+				index = i % len(values)
+			case PlacementFillFirst:
+				index = i / capacity
+				if index >= len(values) {
+					return nil, fmt.Errorf("not enough capacity in '%s' for %d instances", name, count)
+				}
+			case PlacementRandom:
+				index = rnd.Intn(len(values))
+			}
+			res[i][name] = values[index]
+		}
+	}
+	return res, nil
+}
+
+// get the seed for the random placement (by default, derived from the machine
+// definition), mixed with the "for_each" values so every combination is different
+func (p *placementConfig) seed(definition string, each map[string]string) (int64, error) {
+	h := fnv.New64a()
+	if len(p.Seed) > 0 {
+		seed, err := strconv.ParseInt(p.Seed, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid placement seed '%s'", p.Seed)
+		}
+		if len(each) == 0 {
+			return seed, nil
+		}
+		h.Write([]byte(p.Seed))
+	} else {
+		h.Write([]byte(definition))
+	}
+
+	names := []string{}
+	for name := range each {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h.Write([]byte{0})
+		h.Write([]byte(name + "=" + each[name]))
+	}
+	return int64(h.Sum64()), nil
+}
+
+// Placed returns the values chosen for the distributed driver options of
+// a machine, like "region=tor01", or an empty string if there are none
+func (machine *machineConfig) Placed() string {
+	res := []string{}
+	for name, value := range machine.placed {
+		res = append(res, fmt.Sprintf("%s=%s", name, value))
+	}
+	sort.Strings(res)
+	return strings.Join(res, ",")
+}
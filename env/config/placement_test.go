@@ -0,0 +1,110 @@
+package config_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func populatePlacement(t *testing.T, placement string, instances int) *config.Config {
+	s := fmt.Sprintf(`
+machines:
+  worker:
+    instances: %d
+    placement: %s
+    driver:
+      softlayer:
+        region: [tor01, dal05, sjc01]
+        zone:   [a, b]
+        memory: 1024
+`, instances, placement)
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(s), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+	return &cfg
+}
+
+func regions(cfg *config.Config, instances int) []string {
+	res := []string{}
+	for i := 1; i <= instances; i++ {
+		res = append(res, cfg.Machines[fmt.Sprintf("worker-%d", i)].Driver.Options.String("region"))
+	}
+	return res
+}
+
+func TestPlacement(t *testing.T) {
+	cfg := populatePlacement(t, "{policy: round-robin}", 4)
+	require.Equal(t, []string{"tor01", "dal05", "sjc01", "tor01"}, regions(cfg, 4))
+	require.Equal(t, "region=dal05,zone=b", cfg.Machines["worker-2"].Placed())
+	require.Equal(t, 1024, cfg.Machines["worker-2"].Driver.Options.Int("memory"))
+
+	cfg = populatePlacement(t, "{policy: fill-first}", 4)
+	require.Equal(t, []string{"tor01", "tor01", "dal05", "dal05"}, regions(cfg, 4))
+
+	cfg = populatePlacement(t, "{policy: fill-first, capacity: 3, options: [region]}", 4)
+	require.Equal(t, []string{"tor01", "tor01", "tor01", "dal05"}, regions(cfg, 4))
+	require.Equal(t, "region=dal05", cfg.Machines["worker-4"].Placed())
+
+	// the random placement is always the same for the same seed
+	cfg = populatePlacement(t, "{policy: random, seed: 42}", 6)
+	placed := regions(cfg, 6)
+	for i := 0; i < 3; i++ {
+		cfg = populatePlacement(t, "{policy: random, seed: 42}", 6)
+		require.Equal(t, placed, regions(cfg, 6))
+	}
+
+	for _, placement := range []string{
+		"{policy: unknown}",
+		"{policy: fill-first, capacity: 1}",
+		"{policy: round-robin, options: [unknown]}",
+	} {
+		s := fmt.Sprintf(`
+machines:
+  worker:
+    instances: 4
+    placement: %s
+    driver:
+      softlayer:
+        region: [tor01, dal05, sjc01]
+`, placement)
+		cfg := config.Config{}
+		require.NoError(t, yaml.Unmarshal([]byte(s), &cfg))
+		require.Error(t, cfg.Populate(nil, nil, nil), "error not detected for %s", placement)
+	}
+}
+
+func TestPlacementRandomForEach(t *testing.T) {
+	// every combination of the "for_each" values gets its own random placement
+	for _, placement := range []string{"{policy: random}", "{policy: random, seed: 42}"} {
+		s := fmt.Sprintf(`
+machines:
+  worker:
+    instances: 8
+    for_each:
+      tier: [front, back]
+    placement: %s
+    driver:
+      softlayer:
+        region: [tor01, dal05, sjc01]
+`, placement)
+		cfg := config.Config{}
+		require.NoError(t, yaml.Unmarshal([]byte(s), &cfg))
+		require.NoError(t, cfg.Populate(nil, nil, nil))
+
+		placed := map[string][]string{}
+		for _, tier := range []string{"front", "back"} {
+			for i := 1; i <= 8; i++ {
+				name := fmt.Sprintf("worker-%s-%d", tier, i)
+				require.Contains(t, cfg.Machines, name)
+				placed[tier] = append(placed[tier], cfg.Machines[name].Driver.Options.String("region"))
+			}
+		}
+		require.NotEqual(t, placed["front"], placed["back"], "same placement for all the combinations with %s", placement)
+	}
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Position is a position in a configuration file
+type Position struct {
+	File string
+	Line int
+}
+
+// IsValid returns true if the position points to a file
+func (p Position) IsValid() bool {
+	return len(p.File) > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return ""
+	}
+	if p.Line <= 0 {
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// positionsMap maps paths like "machines.master.swarm.discovery" to positions
+type positionsMap map[string]Position
+
+// get the position for a path or, when not known, for its closest parent
+func (m positionsMap) lookup(path string) Position {
+	for len(path) > 0 {
+		if p, found := m[path]; found {
+			return p
+		}
+		i := strings.LastIndex(path, ".")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+	return Position{}
+}
+
+// update the positions with the positions in another map
+func (m positionsMap) update(other positionsMap) {
+	for k, v := range other {
+		m[k] = v
+	}
+}
+
+// join some keys in a path
+func keysPath(keys ...string) string {
+	return strings.Join(keys, ".")
+}
+
+// a key at the beginning of a line, like in "key:" or "key: value"
+var keyRegexp = regexp.MustCompile(`^("[^"]*"|'[^']*'|[^\s"'#\-\[\]{}][^:]*?)\s*:(\s|$)`)
+
+// a block scalar indicator at the end of a line, like in "key: |"
+var blockScalarRegexp = regexp.MustCompile(`:\s+[|>][-+0-9]*\s*$`)
+
+// indexPositions gets the positions of all the keys in a YAML document
+//
+// This is not a YAML parser: it only understands the block mappings used in
+// configuration files, and keys inside lists or flow mappings are ignored.
+func indexPositions(filename string, b []byte) positionsMap {
+	type level struct {
+		indent int
+		key    string
+	}
+
+	res := positionsMap{}
+	stack := []level{}
+	blockIndent := -1
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		trimmed := strings.TrimLeft(line, " ")
+		if len(trimmed) == 0 || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "---") {
+			continue
+		}
+		indent := len(line) - len(trimmed)
+
+		// skip the contents of block scalars
+		if blockIndent >= 0 {
+			if indent > blockIndent {
+				continue
+			}
+			blockIndent = -1
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+
+		m := keyRegexp.FindStringSubmatch(trimmed)
+		if m == nil {
+			continue
+		}
+		key := strings.Trim(m[1], `"'`)
+		stack = append(stack, level{indent: indent, key: key})
+
+		keys := []string{}
+		for _, l := range stack {
+			keys = append(keys, l.key)
+		}
+		path := keysPath(keys...)
+		if _, found := res[path]; !found {
+			res[path] = Position{File: filename, Line: lineNum}
+		}
+
+		if blockScalarRegexp.MatchString(trimmed) {
+			blockIndent = indent
+		}
+	}
+	return res
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexPositions(t *testing.T) {
+	const s = `# docker-env.yml
+vars:
+  NUM_WORKERS:   10
+
+engine:
+  labels:   [a, b]
+  opt:
+    - a
+    - b
+  install-url: |
+    not: a key
+  storage-driver: aufs
+
+machines:
+  "master":
+    instances: 1
+  worker-$(#):
+    instances: $(NUM_WORKERS)   # a comment: with colon
+    driver:
+      openstack:
+        flavor-name:  tiny
+`
+	positions := indexPositions("docker-env.yml", []byte(s))
+
+	for path, line := range map[string]int{
+		"vars":                           2,
+		"vars.NUM_WORKERS":               3,
+		"engine.labels":                  6,
+		"engine.opt":                     7,
+		"engine.install-url":             10,
+		"engine.storage-driver":          12,
+		"machines.master":                15,
+		"machines.master.instances":      16,
+		"machines.worker-$(#).instances": 18,
+		"machines.worker-$(#).driver.openstack.flavor-name": 21,
+	} {
+		p, found := positions[path]
+		require.True(t, found, "%s not found", path)
+		require.Equal(t, line, p.Line, "line mismatch for %s", path)
+		require.Equal(t, "docker-env.yml", p.File, "file mismatch for %s", path)
+	}
+
+	_, found := positions["engine.install-url.not"]
+	require.False(t, found, "key found in a block scalar")
+
+	p := positions.lookup("machines.worker-$(#).driver.openstack.region")
+	require.Equal(t, "docker-env.yml:20", p.String(), "lookup of an unknown key")
+	require.False(t, positions.lookup("unknown").IsValid(), "lookup of an unknown section")
+}
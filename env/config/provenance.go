@@ -0,0 +1,264 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Origin is a place where a value in the configuration comes from
+type Origin struct {
+	// a description of the origin, like "default" or "global section 'engine'"
+	Source string
+	// the position in the configuration files (if any)
+	Position Position
+	// the value (as written in the origin, before replacing variables)
+	Value interface{}
+}
+
+func (o Origin) String() string {
+	s := o.Source
+	if o.Position.IsValid() {
+		s = fmt.Sprintf("%s (%s)", o.Position, o.Source)
+	}
+	if o.Value != nil {
+		s += ": " + FormatValue(o.Value)
+	}
+	return s
+}
+
+// FormatValue formats a value in a tree like in a (flow style) YAML
+func FormatValue(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return ""
+	case yaml.MapSlice:
+		items := []string{}
+		for _, item := range vv {
+			items = append(items, fmt.Sprintf("%v: %s", item.Key, FormatValue(item.Value)))
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	case []interface{}:
+		items := []string{}
+		for _, e := range vv {
+			items = append(items, FormatValue(e))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
+
+// Explanation explains where the value of a key in a machine comes from
+type Explanation struct {
+	Machine string
+	Key     string
+	Value   interface{}
+	// the origins, from the lowest to the highest precedence
+	Origins []Origin
+}
+
+// a value set for some path in some file
+type contribution struct {
+	Position Position
+	Value    interface{}
+}
+
+// historyMap keeps all the values set for every path, in the order they were loaded
+type historyMap map[string][]contribution
+
+// record all the values in a tree loaded from a file
+func (h historyMap) record(tree yaml.MapSlice, positions positionsMap, path string) {
+	for _, item := range tree {
+		itemPath := fmt.Sprint(item.Key)
+		if len(path) > 0 {
+			itemPath = keysPath(path, itemPath)
+		}
+		if m, ok := item.Value.(yaml.MapSlice); ok && len(m) > 0 {
+			h.record(m, positions, itemPath)
+			continue
+		}
+		h[itemPath] = append(h[itemPath], contribution{
+			Position: positions.lookup(itemPath),
+			Value:    item.Value,
+		})
+	}
+}
+
+// SetVar sets a variable from a source different to the configuration files,
+// like the command line
+func (config *Config) SetVar(name, value, source string) {
+	if config.Vars == nil {
+		config.Vars = varsMap{}
+	}
+	if config.varSources == nil {
+		config.varSources = map[string]string{}
+	}
+	config.Vars[name] = value
+	config.varSources[name] = source
+}
+
+// Explain explains where the values of a (populated) machine come from, for
+// a key like "engine.storage-driver" or for all of them when no key is provided
+func (config *Config) Explain(machineName string, key string) ([]Explanation, error) {
+	machine, found := config.Machines[machineName]
+	if !found {
+		return nil, fmt.Errorf("unknown machine '%s'", machineName)
+	}
+
+	tree, err := config.ResolvedTree(machineName)
+	if err != nil {
+		return nil, err
+	}
+	values, _ := treeLookup(tree, machinesKey, machineName)
+	leaves := map[string]interface{}{}
+	keys := []string{}
+	flattenTree(values, "", func(path string, value interface{}) {
+		leaves[path] = value
+		keys = append(keys, path)
+	})
+
+	if len(key) > 0 {
+		if _, found := leaves[key]; !found {
+			return nil, fmt.Errorf("unknown key '%s' in machine '%s'", key, machineName)
+		}
+		keys = []string{key}
+	}
+
+	res := []Explanation{}
+	for _, k := range keys {
+		res = append(res, Explanation{
+			Machine: machineName,
+			Key:     k,
+			Value:   leaves[k],
+			Origins: config.origins(machine, k, leaves[k]),
+		})
+	}
+	return res, nil
+}
+
+// get the origins of a key in a machine
+func (config *Config) origins(machine *machineConfig, key string, value interface{}) []Origin {
+	res := []Origin{}
+	section := strings.SplitN(key, ".", 2)[0]
+
+	_, inMachine := treeLookup(config.tree, machinesKey, machine.definition, section)
+	if inMachine || section == "instances" {
+		// the value comes from the machine definition or from the definitions it extends
+		defs := append(config.extends.ancestors(machine.definition), machine.definition)
+		for _, def := range defs {
+			source := fmt.Sprintf("machine '%s'", def)
+			if def != machine.definition {
+				source = fmt.Sprintf("extended '%s'", def)
+			}
+			for _, s := range []string{machinesKey, templatesKey} {
+				for _, c := range config.history[keysPath(s, def, key)] {
+					res = append(res, Origin{Source: source, Position: c.Position, Value: c.Value})
+				}
+			}
+		}
+	} else {
+		source := fmt.Sprintf("global section '%s'", section)
+		for _, c := range config.history[key] {
+			res = append(res, Origin{Source: source, Position: c.Position, Value: c.Value})
+		}
+	}
+
+	// the overrides for this instance
+	for _, k := range machine.overridden {
+		for _, c := range config.history[keysPath(machinesKey, machine.definition, overridesKey, k, key)] {
+			res = append(res, Origin{Source: fmt.Sprintf("override '%s' of '%s'", k, machine.definition), Position: c.Position, Value: c.Value})
+		}
+	}
+
+	if len(res) == 0 {
+		return []Origin{{Source: "default", Value: value}}
+	}
+
+	// explain the variables used in the final value
+	if s, ok := res[len(res)-1].Value.(string); ok {
+		for _, name := range varNames(s) {
+			res = append(res, config.varOrigins(machine, name)...)
+		}
+	}
+
+	if section == "instances" && machine.Name != machine.definition {
+		res = append(res, Origin{Source: fmt.Sprintf("instance of '%s'", machine.definition), Value: value})
+	}
+	return res
+}
+
+// get the origins of a variable used in a machine
+func (config *Config) varOrigins(machine *machineConfig, name string) []Origin {
+	if name == "#" {
+		return []Origin{{Source: "variable '#' (the instance number)"}}
+	}
+	if isInstanceVar(name) || name == envNameVar || name == machineBasenameVar {
+		return []Origin{{Source: fmt.Sprintf("built-in variable '%s'", name)}}
+	}
+
+	if strings.HasPrefix(name, secretVarPrefix) {
+		// never show the value of a secret
+		return []Origin{{Source: fmt.Sprintf("secret '%s'", name[len(secretVarPrefix):])}}
+	}
+	if strings.HasPrefix(name, envVarPrefix) {
+		source := fmt.Sprintf("environment variable '%s'", name[len(envVarPrefix):])
+		if v, found := lookupVar(nil, name); found {
+			return []Origin{{Source: source, Value: v}}
+		}
+		return []Origin{{Source: fmt.Sprintf("%s (undefined)", source)}}
+	}
+
+	source := fmt.Sprintf("variable '%s'", name)
+	if _, found := machine.Vars[name]; found {
+		// the variable is defined in the machine, or in the definitions it extends
+		res := []Origin{}
+		for _, def := range append(config.extends.ancestors(machine.definition), machine.definition) {
+			for _, s := range []string{machinesKey, templatesKey} {
+				for _, c := range config.history[keysPath(s, def, "vars", name)] {
+					res = append(res, Origin{Source: fmt.Sprintf("%s in '%s'", source, def), Position: c.Position, Value: c.Value})
+				}
+			}
+		}
+		if len(res) > 0 {
+			return res
+		}
+	}
+	if s, found := config.varSources[name]; found {
+		return []Origin{{Source: fmt.Sprintf("%s from %s", source, s), Value: config.Vars[name]}}
+	}
+	res := []Origin{}
+	for _, c := range config.history[keysPath("vars", name)] {
+		res = append(res, Origin{Source: source, Position: c.Position, Value: c.Value})
+	}
+	if len(res) == 0 {
+		res = append(res, Origin{Source: fmt.Sprintf("%s (undefined)", source)})
+	}
+	return res
+}
+
+// get the names of the variables used in a string
+func varNames(s string) []string {
+	res := []string{}
+	for _, ref := range varRefs(s) {
+		res = append(res, ref.Name)
+	}
+	return res
+}
+
+// call a function for all the leaves in a tree
+func flattenTree(v interface{}, path string, f func(string, interface{})) {
+	if m, ok := v.(yaml.MapSlice); ok && len(m) > 0 {
+		for _, item := range m {
+			itemPath := fmt.Sprint(item.Key)
+			if len(path) > 0 {
+				itemPath = keysPath(path, itemPath)
+			}
+			flattenTree(item.Value, itemPath, f)
+		}
+		return
+	}
+	if len(path) > 0 {
+		f(path, v)
+	}
+}
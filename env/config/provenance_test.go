@@ -0,0 +1,86 @@
+package config_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+vars:
+  NUM_WORKERS: 1
+engine:
+  storage-driver: aufs
+driver:
+  virtualbox:
+    memory: 1024
+templates:
+  base:
+    engine:
+      storage-driver: overlay
+machines:
+  worker:
+    extends: base
+    instances: $(NUM_WORKERS)
+`,
+		"docker-env-production.yml": `
+engine:
+  storage-driver: devicemapper
+machines:
+  master:
+    instances: 1
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load([]string{"production"})
+	require.NoError(t, err)
+	cfg.SetVar("NUM_WORKERS", "2", "the command line")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	explain := func(machine, key string) []config.Origin {
+		exps, err := cfg.Explain(machine, key)
+		require.NoError(t, err)
+		require.Len(t, exps, 1)
+		return exps[0].Origins
+	}
+
+	// values from the global sections, in all the files
+	origins := explain("master", "engine.storage-driver")
+	require.Len(t, origins, 2)
+	require.Equal(t, "global section 'engine'", origins[0].Source)
+	require.Equal(t, "aufs", origins[0].Value)
+	require.Equal(t, 5, origins[0].Position.Line)
+	require.True(t, strings.HasSuffix(origins[1].Position.File, "docker-env-production.yml"))
+	require.Equal(t, "devicemapper", origins[1].Value)
+
+	// values from the templates extended
+	origins = explain("worker-2", "engine.storage-driver")
+	require.Len(t, origins, 1)
+	require.Equal(t, "extended 'base'", origins[0].Source)
+	require.Equal(t, "overlay", origins[0].Value)
+
+	// values with variables
+	origins = explain("worker-2", "instances")
+	require.Len(t, origins, 3)
+	require.Equal(t, "machine 'worker'", origins[0].Source)
+	require.Equal(t, "variable 'NUM_WORKERS' from the command line", origins[1].Source)
+	require.Equal(t, "2", origins[1].Value)
+	require.Equal(t, "instance of 'worker'", origins[2].Source)
+
+	// all the keys
+	exps, err := cfg.Explain("master", "")
+	require.NoError(t, err)
+	require.NotEmpty(t, exps)
+
+	_, err = cfg.Explain("unknown", "")
+	require.Error(t, err)
+	_, err = cfg.Explain("master", "engine.unknown")
+	require.Error(t, err)
+}
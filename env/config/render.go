@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ResolvedTree returns a tree with the resolved machines (or just one of them,
+// when a name is provided), suitable for rendering it as a configuration file.
+// The configuration must have been populated.
+func (config *Config) ResolvedTree(name string) (yaml.MapSlice, error) {
+	names := []string{}
+	if len(name) > 0 {
+		if _, found := config.Machines[name]; !found {
+			return nil, fmt.Errorf("unknown machine '%s'", name)
+		}
+		names = append(names, name)
+	} else {
+		names = config.Machines.Names()
+	}
+
+	machines := yaml.MapSlice{}
+	for _, n := range names {
+		machines = append(machines, yaml.MapItem{Key: n, Value: config.Machines[n]})
+	}
+	return normalizeTree(yaml.MapSlice{{Key: machinesKey, Value: machines}})
+}
+
+// UnresolvedTree returns the merged tree the configuration was loaded from
+// (or just one machine definition, when a name is provided), before replacing
+// variables and expanding instances.
+func (config *Config) UnresolvedTree(name string) (yaml.MapSlice, error) {
+	if config.tree == nil {
+		return nil, fmt.Errorf("the configuration was not loaded from a tree")
+	}
+	if len(name) == 0 {
+		return copyTree(config.tree), nil
+	}
+
+	if i := treeIndex(config.tree, machinesKey); i >= 0 {
+		if machines, ok := config.tree[i].Value.(yaml.MapSlice); ok {
+			if j := treeIndex(machines, name); j >= 0 {
+				return yaml.MapSlice{{Key: machinesKey, Value: copyTree(yaml.MapSlice{machines[j]})}}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown machine definition '%s'", name)
+}
+
+// MarshalTree renders a tree in some format ("yaml" or "json")
+func MarshalTree(tree yaml.MapSlice, format string) ([]byte, error) {
+	switch format {
+	case "", "yaml", "yml":
+		return yaml.Marshal(tree)
+	case "json":
+		buf := bytes.Buffer{}
+		if err := writeJSON(&buf, tree); err != nil {
+			return nil, err
+		}
+		out := bytes.Buffer{}
+		if err := json.Indent(&out, buf.Bytes(), "", "  "); err != nil {
+			return nil, err
+		}
+		out.WriteString("\n")
+		return out.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown format '%s'", format)
+}
+
+// convert anything to a generic tree (MapSlices, lists and scalars)
+func normalizeTree(v interface{}) (yaml.MapSlice, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	tree := yaml.MapSlice{}
+	if err := yaml.Unmarshal(b, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// write a tree as JSON, keeping the order of the keys
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	switch vv := v.(type) {
+	case yaml.MapSlice:
+		buf.WriteString("{")
+		for i, item := range vv {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if err := writeJSON(buf, fmt.Sprint(item.Key)); err != nil {
+				return err
+			}
+			buf.WriteString(":")
+			if err := writeJSON(buf, item.Value); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("}")
+	case []interface{}:
+		buf.WriteString("[")
+		for i, e := range vv {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			if err := writeJSON(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+	default:
+		b, err := json.Marshal(vv)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+	}
+	return nil
+}
+
+// remove the empty values from a tree
+func nonEmptyTree(tree yaml.MapSlice) yaml.MapSlice {
+	res := yaml.MapSlice{}
+	for _, item := range tree {
+		switch v := item.Value.(type) {
+		case nil:
+			continue
+		case string:
+			if len(v) == 0 {
+				continue
+			}
+		case []string:
+			if len(v) == 0 {
+				continue
+			}
+		}
+		res = append(res, item)
+	}
+	return res
+}
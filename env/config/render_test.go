@@ -0,0 +1,114 @@
+package config_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/libmachine"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestResolvedTree(t *testing.T) {
+	const test_config_render = `
+vars:
+  NUM_WORKERS: 2
+engine:
+  labels: [class=worker]
+driver:
+  openstack:
+    flavor-name: tiny
+machines:
+  master:
+    instances: 1
+    swarm:
+      master:    true
+      discovery: token://1234
+  worker:
+    instances: $(NUM_WORKERS)
+`
+	cfg, err := config.NewConfigFromTree(parseTree(t, test_config_render))
+	require.NoError(t, err)
+	api := libmachine.NewClient(mcndirs.GetBaseDir())
+	require.NoError(t, cfg.Populate(api, cfg, nil))
+
+	tree, err := cfg.ResolvedTree("")
+	require.NoError(t, err)
+
+	// the rendered configuration must be a valid configuration
+	b, err := config.MarshalTree(tree, "yaml")
+	require.NoError(t, err)
+	rendered := config.Config{}
+	require.NoError(t, yaml.Unmarshal(b, &rendered), "could not parse:\n%s", b)
+
+	require.Len(t, rendered.Machines, 3, "wrong number of machines")
+	for name, machine := range cfg.Machines {
+		r := rendered.Machines[name]
+		require.NotNil(t, r, "machine %s not rendered", name)
+		require.Equal(t, "1", r.Instances, "instances mismatch")
+		require.Equal(t, machine.Engine.Labels, r.Engine.Labels, "labels mismatch")
+		require.Equal(t, machine.Engine.StorageDriver, r.Engine.StorageDriver, "storage driver mismatch")
+		require.Equal(t, machine.Driver.Name, r.Driver.Name, "driver mismatch")
+		require.Equal(t, machine.Auth.CaCertPath, r.Auth.CaCertPath, "CA cert mismatch")
+		if name == "master" {
+			require.NotNil(t, r.Swarm, "swarm section not rendered")
+			require.True(t, r.Swarm.Master, "swarm master mismatch")
+			require.Equal(t, "token://1234", r.Swarm.Discovery, "discovery mismatch")
+		} else {
+			require.Nil(t, r.Swarm, "swarm section rendered for a non-swarm machine")
+		}
+	}
+
+	tree, err = cfg.ResolvedTree("worker-2")
+	require.NoError(t, err)
+	b, err = config.MarshalTree(tree, "json")
+	require.NoError(t, err)
+	m := map[string]map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(b, &m), "invalid JSON:\n%s", b)
+	require.Len(t, m["machines"], 1, "wrong number of machines")
+	require.Contains(t, m["machines"], "worker-2", "worker-2 not rendered")
+
+	_, err = cfg.ResolvedTree("unknown")
+	require.Error(t, err, "unknown machine rendered")
+
+	tree, err = cfg.UnresolvedTree("worker")
+	require.NoError(t, err)
+	b, err = config.MarshalTree(tree, "yaml")
+	require.NoError(t, err)
+	require.Contains(t, string(b), "$(NUM_WORKERS)", "variables replaced in the unresolved tree")
+}
+
+func TestResolvedTreeRoundTrip(t *testing.T) {
+	const test_config_round_trip = `
+auth:
+  server-cert-SANs: [master.local, 10.0.0.1]
+engine:
+  labels: [class=worker]
+machines:
+  master:
+    instances: 1
+  worker:
+    instances: 2
+`
+	api := libmachine.NewClient(mcndirs.GetBaseDir())
+
+	cfg := config.Config{}
+	require.NoError(t, yaml.Unmarshal([]byte(test_config_round_trip), &cfg))
+	require.NoError(t, cfg.Populate(api, nil, nil))
+	tree, err := cfg.ResolvedTree("")
+	require.NoError(t, err)
+	out, err := config.MarshalTree(tree, "yaml")
+	require.NoError(t, err)
+
+	// the rendered configuration can be loaded again, with the same result
+	again := config.Config{}
+	require.NoError(t, yaml.Unmarshal(out, &again), "cannot load the rendered configuration:\n%s", out)
+	require.NoError(t, again.Populate(api, nil, nil))
+	againTree, err := again.ResolvedTree("")
+	require.NoError(t, err)
+	require.Equal(t, tree, againTree)
+	require.Equal(t, []string{"master.local", "10.0.0.1"}, again.Machines["worker-2"].Auth.ServerCertSANs)
+}
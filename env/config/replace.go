@@ -1,18 +1,25 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 )
 
 // Variables must be like {{.VAR}}
 var varRegexp = regexp.MustCompile(`\$\(.*?\)`)
 
-// check if the string has a variable
+// check if the string uses a variable
 func hasVar(s string, v string) bool {
-	return strings.Contains(s, "$(#)")
+	for _, ref := range varRefs(s) {
+		if ref.Name == v {
+			return true
+		}
+	}
+	return false
 }
 
 // check if the string has (at least) one variable like {{.VAR}}
@@ -20,34 +27,338 @@ func hasVars(s string) bool {
 	return varRegexp.MatchString(s)
 }
 
-// replace variables like {{.VAR}}
+// a reference to a variable, like "NAME", "NAME:-default", "NAME:?message"
+// or "NAME:03" (for a number with a width)
+type varRef struct {
+	Name string
+	// the modifier (":-", ":?" or ":") and its argument
+	Op  string
+	Arg string
+}
+
+// a width for formatting a number, like the "03" in "$(#:03)"
+var varWidthRegexp = regexp.MustCompile(`:([0-9]+)$`)
+
+// parse the contents of a variable, like the "NAME:-default" in "$(NAME:-default)"
+func parseVarRef(s string) varRef {
+	for _, op := range []string{":-", ":?"} {
+		if i := strings.Index(s, op); i >= 0 {
+			return varRef{Name: s[:i], Op: op, Arg: s[i+len(op):]}
+		}
+	}
+	if m := varWidthRegexp.FindStringSubmatchIndex(s); m != nil {
+		return varRef{Name: s[:m[0]], Op: ":", Arg: s[m[2]:m[3]]}
+	}
+	return varRef{Name: s}
+}
+
+// requiredVarError is returned when a variable like "$(NAME:?message)" is not set
+type requiredVarError struct {
+	Name    string
+	Message string
+}
+
+func (e requiredVarError) Error() string {
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("variable '%s' is required but it is not set", e.Name)
+	}
+	return fmt.Sprintf("variable '%s' is required: %s", e.Name, e.Message)
+}
+
+// unknownVarsError is returned when some variables are not defined
+type unknownVarsError []string
+
+func (e unknownVarsError) Error() string {
+	return fmt.Sprintf("unknown variable(s): %v", []string(e))
+}
+
+// call a function for all the variables in a string, replacing them by the
+// result. Parenthesis are balanced, so variables can be nested like in
+// "$(A:-$(B))", and only the outermost variables are replaced.
+func replaceVarsFunc(s string, repl func(string) string) string {
+	res := bytes.Buffer{}
+	for {
+		start := strings.Index(s, "$(")
+		if start < 0 {
+			break
+		}
+		end, depth := -1, 0
+		for i := start + 1; i < len(s) && end < 0; i++ {
+			switch s[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+		if end < 0 {
+			break
+		}
+		res.WriteString(s[:start])
+		res.WriteString(repl(s[start : end+1]))
+		s = s[end+1:]
+	}
+	res.WriteString(s)
+	return res.String()
+}
+
+// get all the variables referenced in a string, including the variables
+// nested in default values and messages
+func varRefs(s string) []varRef {
+	res := []varRef{}
+	replaceVarsFunc(s, func(k string) string {
+		content := k[2 : len(k)-1]
+		if isExpr(content, nil) {
+			if _, names, err := parseExpr(content); err == nil {
+				for _, name := range names {
+					res = append(res, varRef{Name: name})
+				}
+			}
+			return k
+		}
+		ref := parseVarRef(content)
+		res = append(res, ref)
+		res = append(res, varRefs(ref.Arg)...)
+		return k
+	})
+	return res
+}
+
+// replace variables like $(VAR), $(VAR:-default) or $(VAR:?message), where
+// the variable can also be an environment variable like $(env:HOME)
+//
+// or an expression like $(NUM_WORKERS * 2)
+//
+// Like in the shell, the default value is used and the required error is
+// raised when the variable is not set or when it is empty. Unknown variables
+// are left untouched (and reported in an unknownVarsError), but a required
+// variable that is missing is always returned as a requiredVarError (and
+// an invalid expression as an exprError).
 func replaceVars(s string, vars map[string]string) (string, error) {
-	unknown := []string{}
-	repl := func(k string) string {
-		kk := k[2 : len(k)-1] // take out the ".{{" and the "}}"
-		if v, found := vars[kk]; found {
+	unknown := unknownVarsError{}
+	var failed error
+	var repl func(k string) string
+	repl = func(k string) string {
+		content := k[2 : len(k)-1] // take out the "$(" and the ")"
+		if isExpr(content, vars) {
+			v, err := evalExpr(content, vars)
+			if u, ok := err.(unknownVarsError); ok {
+				unknown = append(unknown, u...)
+				return k
+			} else if err != nil {
+				if failed == nil {
+					failed = err
+				}
+				return k
+			}
+			return v
+		}
+
+		ref := parseVarRef(content)
+		v, found := lookupVar(vars, ref.Name)
+		switch ref.Op {
+		case ":-":
+			if !found || len(v) == 0 {
+				// the default value can contain other variables
+				return replaceVarsFunc(ref.Arg, repl)
+			}
+		case ":?":
+			if !found || len(v) == 0 {
+				if failed == nil {
+					failed = requiredVarError{Name: ref.Name, Message: ref.Arg}
+				}
+				return k
+			}
+		case ":":
+			if found {
+				formatted, err := formatVar(v, ref.Arg)
+				if err != nil {
+					if failed == nil {
+						failed = fmt.Errorf("cannot format variable '%s': %s", ref.Name, err)
+					}
+					return k
+				}
+				return formatted
+			}
+		}
+		if found {
 			return v
-		} else {
-			unknown = append(unknown, kk)
-			return k
 		}
+		unknown = append(unknown, ref.Name)
+		return k
 	}
 
-	replaced := varRegexp.ReplaceAllStringFunc(s, repl)
+	replaced := replaceVarsFunc(s, repl)
+	if failed != nil {
+		return replaced, failed
+	}
 	if len(unknown) > 0 {
-		return replaced, fmt.Errorf("unknown variable(s): %v", unknown)
+		return replaced, unknown
 	}
 	return replaced, nil
 }
 
-func ReplaceAllStringMap(obj interface{}, replacements map[string]string) interface{} {
-	return ReplaceAllStringFunc(obj, func(in string) string {
+// resolve the variables that reference other variables, in dependency order.
+// Variables can reference the instance number, $(#), and the other variables
+// that depend on the instance, that are left untouched.
+//
+// When a machine is provided, its variables shadow the global variables, also
+// when they are referenced from global variables.
+//
+// References to undefined variables are left untouched and reported to the
+// undefined validator or, when it is nil, checked before returning.
+func (config *Config) resolveVars(machine *machineConfig, undefined *validator) (map[string]string, error) {
+	check := undefined == nil
+	if check {
+		undefined = &validator{config: config}
+	}
+	r := varsResolver{
+		config:    config,
+		machine:   machine,
+		vars:      map[string]string{},
+		resolved:  map[string]string{},
+		undefined: undefined,
+	}
+	for k, v := range config.Vars {
+		r.vars[k] = v
+	}
+	if machine != nil {
+		for k, v := range machine.Vars {
+			r.vars[k] = v
+		}
+	}
+	for k, v := range config.builtinVars(machine) {
+		r.vars[k] = v
+	}
+	// secrets are used as they are, without replacing anything in them
+	for k, v := range config.secrets {
+		r.resolved[secretVarPrefix+k] = v
+	}
+
+	names := []string{}
+	for name := range r.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names) // report always the same errors
+
+	for _, name := range names {
+		if _, err := r.resolve(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	if check {
+		if err := undefined.checkUndefinedVars(); err != nil {
+			return nil, err
+		}
+	}
+	return r.resolved, nil
+}
+
+// varsResolver resolves variables, detecting cycles
+type varsResolver struct {
+	config   *Config
+	machine  *machineConfig
+	vars     map[string]string
+	resolved map[string]string
+	// where the references to undefined variables are reported
+	undefined *validator
+}
+
+// resolve a variable, where chain is the list of variables being resolved
+func (r *varsResolver) resolve(name string, chain []string) (string, error) {
+	if v, found := r.resolved[name]; found {
+		return v, nil
+	}
+	for i, c := range chain {
+		if c == name {
+			return "", r.errorf(name, "cycle in variables: %s", strings.Join(append(chain[i:], name), " -> "))
+		}
+	}
+	chain = append(append([]string{}, chain...), name)
+
+	value := r.vars[name]
+	for _, ref := range varRefs(value) {
+		if _, found := r.vars[ref.Name]; found {
+			if _, err := r.resolve(ref.Name, chain); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	replaced, err := replaceVars(value, r.resolved)
+	if unknown, ok := err.(unknownVarsError); ok {
+		for _, u := range unknown {
+			if !isInstanceVar(u) && !strings.HasPrefix(u, "machine.") {
+				r.undefined.add(r.errorf(name, "variable '%s' references an undefined variable '%s'", name, u))
+			}
+		}
+	} else if err != nil {
+		return "", r.errorf(name, "variable '%s': %s", name, err)
+	}
+	r.resolved[name] = replaced
+	return replaced, nil
+}
+
+// an error in the definition of a variable
+func (r *varsResolver) errorf(name string, format string, args ...interface{}) error {
+	if r.machine != nil {
+		if _, found := r.machine.Vars[name]; found {
+			return r.config.errorAt(keysPath(machinesKey, r.machine.definition, "vars", name), r.machine.Name, format, args...)
+		}
+	}
+	if source, found := r.config.varSources[name]; found {
+		return fmt.Errorf("%s (defined in %s)", fmt.Sprintf(format, args...), source)
+	}
+	return r.config.errorAt(keysPath("vars", name), "", format, args...)
+}
+
+// ReplaceAllStringMap replaces the variables in all the strings in an object,
+// failing when some variables are not defined
+func ReplaceAllStringMap(obj interface{}, replacements map[string]string) (interface{}, error) {
+	var firstErr error
+	undefined := unknownVarsError{}
+	res := ReplaceAllStringFunc(obj, func(in string) string {
 		replaced, err := replaceVars(in, replacements)
+		switch e := err.(type) {
+		case nil:
+			return replaced
+		case unknownVarsError:
+			undefined = append(undefined, e...)
+		default:
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return in
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if len(undefined) > 0 {
+		return nil, undefined
+	}
+	return res, nil
+}
+
+// replace the variables in all the strings in an object, leaving unknown
+// variables untouched but failing when a required variable is not set or
+// when an expression is not valid
+func replaceAllVars(obj interface{}, vars map[string]string) (interface{}, error) {
+	var firstErr error
+	res := ReplaceAllStringFunc(obj, func(in string) string {
+		replaced, err := replaceVars(in, vars)
 		if err != nil {
+			if _, ok := err.(unknownVarsError); !ok && firstErr == nil {
+				firstErr = err
+			}
 			return in
 		}
 		return replaced
 	})
+	return res, firstErr
 }
 
 func ReplaceAllStringFunc(obj interface{}, replacer func(string) string) interface{} {
@@ -87,6 +398,10 @@ func replaceRecursive(copy, original reflect.Value, replacer func(string) string
 	case reflect.Interface:
 		// Get rid of the wrapping interface
 		originalValue := original.Elem()
+		// Check if the interface is nil
+		if !originalValue.IsValid() {
+			return
+		}
 		// Create a new object. Now new gives us a pointer, but we want the value it
 		// points to, so we have to call Elem() to unwrap it
 		copyValue := reflect.New(originalValue.Type()).Elem()
@@ -25,6 +25,39 @@ func TestReplaceVars(t *testing.T) {
 	require.Equal(t, replaced, "databases: 1 workers: 5 $(UNKNOWN)")
 }
 
+func TestReplaceVarsModifiers(t *testing.T) {
+	vars := map[string]string{
+		"NUM_WORKERS": "5",
+		"EMPTY":       "",
+	}
+
+	replaced, err := replaceVars("workers: $(NUM_WORKERS:-1) queues: $(NUM_QUEUES:-2) $(EMPTY:-none)", vars)
+	require.NoError(t, err)
+	require.Equal(t, "workers: 5 queues: 2 none", replaced)
+
+	replaced, err = replaceVars("workers: $(NUM_WORKERS:?must be set)", vars)
+	require.NoError(t, err)
+	require.Equal(t, "workers: 5", replaced)
+
+	for _, s := range []string{"$(DISCOVERY:?use -X DISCOVERY=token://...)", "$(EMPTY:?)"} {
+		_, err = replaceVars(s, vars)
+		require.Error(t, err, "required variable not detected in %s", s)
+		require.IsType(t, requiredVarError{}, err)
+	}
+	_, err = replaceVars("$(DISCOVERY:?use a token)", vars)
+	require.Contains(t, err.Error(), "use a token")
+
+	// required variables are not ignored when replacing in objects
+	type testStruct struct {
+		A string
+		B string
+	}
+	_, err = replaceAllVars(testStruct{A: "$(UNKNOWN)", B: "$(NUM_WORKERS)"}, vars)
+	require.NoError(t, err)
+	_, err = replaceAllVars(testStruct{A: "$(UNKNOWN)", B: "$(DISCOVERY:?)"}, vars)
+	require.Error(t, err)
+}
+
 func TestReplace(t *testing.T) {
 	scs := spew.ConfigState{
 		Indent:   "\t",
@@ -63,6 +96,64 @@ func TestReplace(t *testing.T) {
 	})
 	require.True(t, reflect.DeepEqual(translated, expected), scs.Sdump(translated))
 
-	translated = ReplaceAllStringMap(a, vars)
+	translated, err := ReplaceAllStringMap(a, vars)
+	require.NoError(t, err)
 	require.True(t, reflect.DeepEqual(translated, expected), scs.Sdump(translated))
+
+	delete(vars, "NUM_WORKERS")
+	_, err = ReplaceAllStringMap(a, vars)
+	require.Error(t, err, "undefined variables must be reported")
+	require.Contains(t, err.Error(), "NUM_WORKERS")
+}
+
+func TestReplaceVarsNested(t *testing.T) {
+	vars := map[string]string{
+		"CONSUL_HOST": "consul.local",
+	}
+
+	replaced, err := replaceVars("consul://$(CONSUL_ADDR:-$(CONSUL_HOST):8500)", vars)
+	require.NoError(t, err)
+	require.Equal(t, "consul://consul.local:8500", replaced)
+
+	refs := varRefs("$(A:-$(B:?$(C))) $(D)")
+	names := []string{}
+	for _, ref := range refs {
+		names = append(names, ref.Name)
+	}
+	require.Equal(t, []string{"A", "B", "C", "D"}, names)
+}
+
+func TestResolveVars(t *testing.T) {
+	cfg := Config{Vars: varsMap{
+		"DISCOVERY":   "consul://$(CONSUL_ADDR)",
+		"CONSUL_ADDR": "$(CONSUL_HOST):$(CONSUL_PORT:-8500)",
+		"CONSUL_HOST": "consul.local",
+		"NODE":        "node-$(#)",
+	}}
+	vars, err := cfg.resolveVars(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "consul://consul.local:8500", vars["DISCOVERY"])
+	require.Equal(t, "node-$(#)", vars["NODE"], "the instance number must be kept")
+
+	// overrides are resolved too
+	cfg.SetVar("CONSUL_HOST", "$(NODE).consul", "the command line")
+	vars, err = cfg.resolveVars(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, "consul://node-$(#).consul:8500", vars["DISCOVERY"])
+
+	cfg = Config{Vars: varsMap{
+		"A": "$(B)",
+		"B": "x-$(C)",
+		"C": "$(A)",
+	}}
+	_, err = cfg.resolveVars(nil, nil)
+	require.Error(t, err, "cycle not detected")
+	require.Contains(t, err.Error(), "A -> B -> C -> A")
+
+	cfg = Config{Vars: varsMap{
+		"A": "$(UNDEFINED)",
+	}}
+	_, err = cfg.resolveVars(nil, nil)
+	require.Error(t, err, "undefined variable not detected")
+	require.Contains(t, err.Error(), "UNDEFINED")
 }
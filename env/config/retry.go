@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const retryKey = "retry"
+
+// the keys that can be used in a "retry" section
+var retrySchema = sectionSchema{
+	"attempts":  intValue,
+	"delay":     scalarValue,
+	"max-delay": scalarValue,
+}
+
+// RetryPolicy is the way failed driver operations are retried: up to
+// Attempts times, waiting Delay after the first failure and doubling
+// the delay after every failure, up to MaxDelay
+type RetryPolicy struct {
+	Attempts int
+	Delay    time.Duration
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is the policy used when there is no "retry" section:
+// operations are not retried
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 1,
+	Delay:    time.Second,
+	MaxDelay: 30 * time.Second,
+}
+
+// Backoff returns the delay before a retry (the first retry is 1)
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := p.Delay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// retryConfig is the "retry" section, global or in a machine definition, like
+//
+//	retry:
+//	  attempts:   5
+//	  delay:      2s
+//	  max-delay:  1m
+//
+// The keys not set in a machine are taken from the global section.
+type retryConfig struct {
+	Attempts string `yaml:"attempts,omitempty"`
+	Delay    string `yaml:"delay,omitempty"`
+	MaxDelay string `yaml:"max-delay,omitempty"`
+}
+
+func (retry *retryConfig) Copy() *retryConfig {
+	if retry == nil {
+		return nil
+	}
+	res := *retry
+	return &res
+}
+
+func (retry retryConfig) MarshalYAML() (interface{}, error) {
+	res := yaml.MapSlice{}
+	if n, err := strconv.Atoi(retry.Attempts); err == nil {
+		res = append(res, yaml.MapItem{Key: "attempts", Value: n})
+	} else if len(retry.Attempts) > 0 {
+		res = append(res, yaml.MapItem{Key: "attempts", Value: retry.Attempts})
+	}
+	if len(retry.Delay) > 0 {
+		res = append(res, yaml.MapItem{Key: "delay", Value: retry.Delay})
+	}
+	if len(retry.MaxDelay) > 0 {
+		res = append(res, yaml.MapItem{Key: "max-delay", Value: retry.MaxDelay})
+	}
+	return res, nil
+}
+
+// inherit the keys that are not set from another section
+func (retry *retryConfig) inherit(parent *retryConfig) *retryConfig {
+	if retry == nil {
+		return parent.Copy()
+	}
+	if parent != nil {
+		if len(retry.Attempts) == 0 {
+			retry.Attempts = parent.Attempts
+		}
+		if len(retry.Delay) == 0 {
+			retry.Delay = parent.Delay
+		}
+		if len(retry.MaxDelay) == 0 {
+			retry.MaxDelay = parent.MaxDelay
+		}
+	}
+	return retry
+}
+
+// policy parses the section, using the defaults for the keys not set
+func (retry *retryConfig) policy() (RetryPolicy, error) {
+	res := DefaultRetryPolicy
+	if retry == nil {
+		return res, nil
+	}
+
+	if len(retry.Attempts) > 0 {
+		attempts, err := strconv.Atoi(retry.Attempts)
+		if err != nil || attempts < 1 {
+			return res, fmt.Errorf("invalid number of attempts '%s'", retry.Attempts)
+		}
+		res.Attempts = attempts
+	}
+	for _, d := range []struct {
+		value string
+		res   *time.Duration
+	}{
+		{retry.Delay, &res.Delay},
+		{retry.MaxDelay, &res.MaxDelay},
+	} {
+		if len(d.value) == 0 {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil || duration < 0 {
+			return res, fmt.Errorf("invalid duration '%s' (use something like '500ms', '2s' or '1m')", d.value)
+		}
+		*d.res = duration
+	}
+	if res.MaxDelay < res.Delay {
+		res.MaxDelay = res.Delay
+	}
+	return res, nil
+}
+
+// RetryPolicy returns the policy for retrying the driver operations in a machine
+func (machine *machineConfig) RetryPolicy() RetryPolicy {
+	// errors are reported when validating
+	policy, _ := machine.Retry.policy()
+	return policy
+}
+
+// RetryPolicyOf returns the retry policy of a machine (the default one for unknown machines)
+func (m machineConfigMap) RetryPolicyOf(name string) RetryPolicy {
+	if machine, found := m[name]; found {
+		return machine.RetryPolicy()
+	}
+	return DefaultRetryPolicy
+}
@@ -0,0 +1,116 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	const test_config_retry = `
+vars:
+  ATTEMPTS: 5
+retry:
+  attempts: 3
+  delay: 2s
+machines:
+  master:
+    instances: 1
+  worker:
+    instances: 2
+    retry:
+      attempts: $(ATTEMPTS)
+      max-delay: 10s
+`
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_retry), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+	require.NoError(t, cfg.Validate(nil))
+
+	require.Equal(t, config.RetryPolicy{Attempts: 3, Delay: 2 * time.Second, MaxDelay: 30 * time.Second},
+		cfg.Machines.RetryPolicyOf("master"))
+	require.Equal(t, config.RetryPolicy{Attempts: 5, Delay: 2 * time.Second, MaxDelay: 10 * time.Second},
+		cfg.Machines.RetryPolicyOf("worker-2"))
+	require.Equal(t, config.DefaultRetryPolicy, cfg.Machines.RetryPolicyOf("unknown"))
+
+	tree, err := cfg.ResolvedTree("worker-1")
+	require.NoError(t, err)
+	b, err := config.MarshalTree(tree, "yaml")
+	require.NoError(t, err)
+	require.Contains(t, string(b), "    retry:\n      attempts: 5\n      delay: 2s\n      max-delay: 10s\n")
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := config.RetryPolicy{Attempts: 10, Delay: time.Second, MaxDelay: 5 * time.Second}
+	delays := []time.Duration{}
+	for retry := 1; retry <= 5; retry++ {
+		delays = append(delays, policy.Backoff(retry))
+	}
+	require.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second,
+	}, delays)
+}
+
+func TestValidateRetry(t *testing.T) {
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+retry:
+  attempts: 0
+  timeout: 1m
+machines:
+  master:
+    instances: 1
+    retry:
+      delay: soon
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	filename := filepath.Join(dir, "docker-env.yml")
+	require.Contains(t, err.Error(), filename+":4: retry.timeout: unknown key 'timeout'")
+	require.Contains(t, err.Error(), filename+":2: retry: invalid number of attempts '0'")
+	require.Contains(t, err.Error(), filename+":8: machine 'master': machines.master.retry: invalid duration 'soon' (use something like '500ms', '2s' or '1m')")
+	require.NotContains(t, err.Error(), "machines.master.retry: invalid number of attempts")
+}
+
+func TestValidateGlobalRetry(t *testing.T) {
+	// errors in the global section are reported once, at their position
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+retry:
+  delay: soon
+machines:
+  master:
+    instances: 1
+  worker:
+    instances: 3
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	errs, ok := err.(config.ValidationErrors)
+	require.True(t, ok, "not a list of validation errors: %s", err)
+	require.Len(t, errs, 1, "wrong number of errors: %s", err)
+	require.Equal(t, filepath.Join(dir, "docker-env.yml")+":2: retry: invalid duration 'soon' (use something like '500ms', '2s' or '1m')", errs[0].Error())
+
+	// also when there are no machines
+	dir, err = loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+retry:
+  attempts: -1
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), filepath.Join(dir, "docker-env.yml")+":2: retry: invalid number of attempts '-1'")
+}
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/crypto/pbkdf2"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	secretsKey      = "secrets"
+	secretVarPrefix = "secret:"
+
+	// the prefix of the encrypted values
+	EncryptedPrefix = "encrypted:"
+
+	// the text that replaces the secrets in the output
+	RedactedValue = "********"
+
+	// shorter secrets are not redacted, as they would redact unrelated output
+	minRedactedLength = 4
+
+	secretsSaltSize      = 16
+	secretsKeySize       = 32
+	secretsKeyIterations = 10000
+)
+
+// SecretsKey is the key for encrypting and decrypting the secrets: the
+// contents of a key file or a passphrase
+type SecretsKey []byte
+
+// LoadSecretsKeyFile loads the key for the secrets from a file
+func LoadSecretsKeyFile(filename string) (SecretsKey, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read the secrets key file: %s", err)
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, fmt.Errorf("The secrets key file %s is empty", filename)
+	}
+	return SecretsKey(b), nil
+}
+
+// Encrypt encrypts a value, returning something like "encrypted:..."
+func (key SecretsKey) Encrypt(plaintext string) (string, error) {
+	salt := make([]byte, secretsSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+	aead, err := key.cipher(salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	// the result is the salt, the nonce and the sealed value
+	res := append(append(salt, nonce...), aead.Seal(nil, nonce, []byte(plaintext), nil)...)
+	return EncryptedPrefix + base64.StdEncoding.EncodeToString(res), nil
+}
+
+// Decrypt decrypts a value encrypted with Encrypt
+func (key SecretsKey) Decrypt(s string) (string, error) {
+	if !strings.HasPrefix(s, EncryptedPrefix) {
+		return "", fmt.Errorf("the value is not encrypted (it must start with '%s')", EncryptedPrefix)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s[len(EncryptedPrefix):]))
+	if err != nil || len(b) < secretsSaltSize {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	aead, err := key.cipher(b[:secretsSaltSize])
+	if err != nil {
+		return "", err
+	}
+	b = b[secretsSaltSize:]
+	if len(b) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	plaintext, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt the value (wrong key?)")
+	}
+	return string(plaintext), nil
+}
+
+// get the cipher for some salt, deriving the key with PBKDF2
+func (key SecretsKey) cipher(salt []byte) (cipher.AEAD, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("no key for the secrets")
+	}
+	block, err := aes.NewCipher(pbkdf2.Key(key, salt, secretsKeyIterations, secretsKeySize, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// HasSecrets returns true if there is a "secrets" section in the configuration
+func (config *Config) HasSecrets() bool {
+	return len(config.Secrets) > 0
+}
+
+// DecryptSecrets decrypts the values in the "secrets" section, so they can be
+// used as $(secret:NAME). The values are only kept in memory, and they are
+// redacted (see Redact) from then on.
+func (config *Config) DecryptSecrets(key SecretsKey) error {
+	names := []string{}
+	for name := range config.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	config.secrets = map[string]string{}
+	for _, name := range names {
+		plaintext, err := key.Decrypt(config.Secrets[name])
+		if err != nil {
+			return config.errorAt(keysPath(secretsKey, name), "", "secret '%s': %s", name, err)
+		}
+		config.secrets[name] = plaintext
+		if len(plaintext) < minRedactedLength {
+			log.Warnf("The secret '%s' is too short for redacting it in the output", name)
+			continue
+		}
+		redactor.add(plaintext)
+	}
+	return nil
+}
+
+// SecretsInFile gets the (encrypted) values in the "secrets" section of the
+// contents of a configuration file
+func SecretsInFile(content []byte) (yaml.MapSlice, error) {
+	tree := yaml.MapSlice{}
+	if err := yaml.Unmarshal(content, &tree); err != nil {
+		return nil, err
+	}
+	secrets, _ := treeMap(tree, secretsKey)
+	return secrets, nil
+}
+
+// ReplaceSecretsInFile replaces the "secrets" section in the contents of a
+// configuration file (or adds it at the end), keeping everything else, like
+// comments and formatting, as it is
+func ReplaceSecretsInFile(content []byte, secrets yaml.MapSlice) ([]byte, error) {
+	section, err := yaml.Marshal(yaml.MapSlice{{Key: secretsKey, Value: secrets}})
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.SplitAfter(string(content), "\n")
+	start, end := secretsBlock(lines)
+	res := ""
+	if start < 0 {
+		res = string(content)
+		if len(res) > 0 && !strings.HasSuffix(res, "\n") {
+			res += "\n"
+		}
+		res += string(section)
+	} else {
+		res = strings.Join(lines[:start], "") + string(section) + strings.Join(lines[end:], "")
+	}
+
+	// check we have not broken anything
+	replaced, err := SecretsInFile([]byte(res))
+	if err != nil {
+		return nil, fmt.Errorf("could not replace the secrets: %s", err)
+	}
+	if fmt.Sprint(replaced) != fmt.Sprint(secrets) {
+		return nil, fmt.Errorf("could not replace the secrets in the file")
+	}
+	return []byte(res), nil
+}
+
+// find the lines of the top-level "secrets" section: the "secrets:" line and
+// all the (indented, blank or comment) lines after it, but the trailing blank ones
+func secretsBlock(lines []string) (int, int) {
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, secretsKey+":") {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return -1, -1
+	}
+
+	end := start + 1
+	for i := start + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if len(trimmed) == 0 {
+			continue
+		}
+		if lines[i][0] != ' ' && lines[i][0] != '\t' {
+			break
+		}
+		end = i + 1
+	}
+	return start, end
+}
+
+/////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// the values that must be redacted in the output
+type redactions struct {
+	sync.Mutex
+	values []string
+}
+
+var redactor = &redactions{}
+
+func (r *redactions) add(value string) {
+	if len(value) < minRedactedLength {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.values = append(r.values, value)
+	// replace the longest values first, in case some secret contains another one
+	sort.Sort(sort.Reverse(byLength(r.values)))
+}
+
+type byLength []string
+
+func (a byLength) Len() int           { return len(a) }
+func (a byLength) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byLength) Less(i, j int) bool { return len(a[i]) < len(a[j]) }
+
+// Redact replaces the values of the secrets in a string, when they are not
+// part of a longer word (so "1234" is not redacted in "12345")
+func Redact(s string) string {
+	redactor.Lock()
+	defer redactor.Unlock()
+	for _, value := range redactor.values {
+		s = replaceToken(s, value, RedactedValue)
+	}
+	return s
+}
+
+// replace a value in a string where it is not preceded or followed by a
+// letter or a digit
+func replaceToken(s, value, replacement string) string {
+	isWordChar := func(b byte) bool {
+		return b == '_' || ('0' <= b && b <= '9') || ('a' <= b && b <= 'z') || ('A' <= b && b <= 'Z')
+	}
+
+	res := ""
+	for {
+		i := strings.Index(s, value)
+		if i < 0 {
+			return res + s
+		}
+		end := i + len(value)
+		if (i > 0 && isWordChar(s[i-1]) && isWordChar(value[0])) ||
+			(end < len(s) && isWordChar(s[end]) && isWordChar(value[len(value)-1])) {
+			res += s[:i+1]
+			s = s[i+1:]
+			continue
+		}
+		res += s[:i] + replacement
+		s = s[end:]
+	}
+}
+
+// redactingWriter is a writer that redacts the secrets written
+type redactingWriter struct {
+	w io.Writer
+}
+
+// NewRedactingWriter creates a writer that redacts the secrets before writing to w
+func NewRedactingWriter(w io.Writer) io.Writer {
+	return redactingWriter{w: w}
+}
+
+func (rw redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
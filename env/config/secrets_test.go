@@ -0,0 +1,164 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSecretsEncryptDecrypt(t *testing.T) {
+	key := config.SecretsKey("some passphrase")
+
+	encrypted, err := key.Encrypt("token://1234")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(encrypted, config.EncryptedPrefix), "wrong encrypted value: %s", encrypted)
+	require.NotContains(t, encrypted, "1234")
+
+	again, err := key.Encrypt("token://1234")
+	require.NoError(t, err)
+	require.NotEqual(t, encrypted, again, "the same value must not be encrypted in the same way")
+
+	decrypted, err := key.Decrypt(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "token://1234", decrypted)
+
+	_, err = config.SecretsKey("another passphrase").Decrypt(encrypted)
+	require.Error(t, err, "a wrong key must not decrypt the value")
+	_, err = key.Decrypt("token://1234")
+	require.Error(t, err, "plain values must not be decrypted")
+
+	// values encrypted by previous versions can still be decrypted
+	decrypted, err = config.SecretsKey("passphrase").Decrypt("encrypted:emT+J0AB8mbdtFNLoUpaNa7il3J2WBONyZzLQjUXqXsxAEE884V4jyjnlZliRnsN2ZvXXhzm0xw=")
+	require.NoError(t, err)
+	require.Equal(t, "token://5678", decrypted)
+}
+
+func TestPopulateSecrets(t *testing.T) {
+	key := config.SecretsKey("some passphrase")
+	token, err := key.Encrypt("token://5678")
+	require.NoError(t, err)
+
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+secrets:
+  discovery: ` + token + `
+vars:
+  DISCOVERY: $(secret:discovery)
+swarm:
+  discovery: $(DISCOVERY)
+machines:
+  master:
+    instances: 1
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.NoError(t, err)
+	require.True(t, cfg.HasSecrets())
+	require.NoError(t, cfg.DecryptSecrets(key))
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+	require.NoError(t, cfg.Validate(nil))
+	require.Equal(t, "token://5678", cfg.Machines["master"].Swarm.Discovery, "discovery mismatch")
+
+	// secrets are redacted in the output
+	require.Equal(t, "discovery: "+config.RedactedValue, config.Redact("discovery: token://5678"))
+	buf := bytes.Buffer{}
+	config.NewRedactingWriter(&buf).Write([]byte("using token://5678\n"))
+	require.Equal(t, "using "+config.RedactedValue+"\n", buf.String())
+
+	require.Equal(t, "port 15678", config.Redact("port 15678"), "only whole values must be redacted")
+
+	explanations, err := cfg.Explain("master", "swarm.discovery")
+	require.NoError(t, err)
+	for _, origin := range explanations[0].Origins {
+		require.NotContains(t, origin.String(), "5678", "secrets must not be explained")
+	}
+}
+
+func TestPopulateSecretsErrors(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+secrets:
+  discovery: token://5678
+machines:
+  master:
+    instances: 1
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.NoError(t, err)
+	err = cfg.DecryptSecrets(config.SecretsKey("some passphrase"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "docker-env.yml:3: secrets.discovery: secret 'discovery': the value is not encrypted")
+
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+	err = cfg.Validate(nil)
+	require.Error(t, err, "plain secrets must not be valid")
+	require.Contains(t, err.Error(), "secrets must be encrypted")
+}
+
+func TestReplaceSecretsInFile(t *testing.T) {
+	const content = `# the production environment
+vars:
+  NUM_WORKERS: 3   # keep it small
+
+secrets:
+  # the old password
+  PASSWORD: encrypted:old
+  TOKEN: encrypted:token
+
+machines: &machines
+  master:
+    instances: 1
+`
+	secrets := yaml.MapSlice{
+		{Key: "PASSWORD", Value: "encrypted:new"},
+		{Key: "API_KEY", Value: "encrypted:key"},
+	}
+	b, err := config.ReplaceSecretsInFile([]byte(content), secrets)
+	require.NoError(t, err)
+	require.Equal(t, `# the production environment
+vars:
+  NUM_WORKERS: 3   # keep it small
+
+secrets:
+  PASSWORD: encrypted:new
+  API_KEY: encrypted:key
+
+machines: &machines
+  master:
+    instances: 1
+`, string(b))
+
+	// the section is added when there is none
+	b, err = config.ReplaceSecretsInFile([]byte("vars:\n  A: 1 # comment"), secrets)
+	require.NoError(t, err)
+	require.Equal(t, "vars:\n  A: 1 # comment\nsecrets:\n  PASSWORD: encrypted:new\n  API_KEY: encrypted:key\n", string(b))
+
+	read, err := config.SecretsInFile(b)
+	require.NoError(t, err)
+	require.Equal(t, secrets, read)
+}
+
+func TestRedactShortSecrets(t *testing.T) {
+	key := config.SecretsKey("some passphrase")
+	short, err := key.Encrypt("on")
+	require.NoError(t, err)
+	pin, err := key.Encrypt("4321")
+	require.NoError(t, err)
+
+	cfg := config.Config{Secrets: map[string]string{"ENABLED": short, "PIN": pin}}
+	require.NoError(t, cfg.DecryptSecrets(key))
+
+	require.Equal(t, "turned on, with pin "+config.RedactedValue, config.Redact("turned on, with pin 4321"))
+	require.Equal(t, "the pin is not 43210", config.Redact("the pin is not 43210"))
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/swarm"
+	"gopkg.in/yaml.v2"
 )
 
 const (
@@ -15,6 +16,15 @@ const (
 
 type swarmConfig swarm.Options
 
+// the keys that can be used in a "swarm" section
+var swarmSchema = sectionSchema{
+	"master":    boolValue,
+	"host":      scalarValue,
+	"discovery": scalarValue,
+	"image":     scalarValue,
+	"strategy":  scalarValue,
+}
+
 func NewSwarmConfig(_ libmachine.API) *swarmConfig {
 	return &swarmConfig{
 		IsSwarm:  false, // swarm disabled by default
@@ -33,6 +43,16 @@ func (swarm *swarmConfig) Populate(api libmachine.API, root *Config, machine *ma
 	return nil
 }
 
+func (swarm swarmConfig) MarshalYAML() (interface{}, error) {
+	return nonEmptyTree(yaml.MapSlice{
+		{Key: "master", Value: swarm.Master},
+		{Key: "host", Value: swarm.Host},
+		{Key: "discovery", Value: swarm.Discovery},
+		{Key: "image", Value: swarm.Image},
+		{Key: "strategy", Value: swarm.Strategy},
+	}), nil
+}
+
 func (swarm *swarmConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	c := make(optionsMap)
 	if err := unmarshal(c); err != nil {
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// typedValue is a value with variables for a field that is not a string, like
+//
+//	engine:
+//	  tls-verify: $(TLS_VERIFY)
+//
+// These values cannot be decoded until the variables have been replaced, so
+// they are taken out of the section and they are decoded for every instance.
+type typedValue struct {
+	Section string
+	Key     string
+	// the value, as written in the configuration
+	Raw  string
+	Kind valueKind
+}
+
+// the path of the field, like "engine.tls-verify"
+func (t typedValue) path() string {
+	return keysPath(t.Section, t.Key)
+}
+
+// decode the value, once the variables have been replaced
+func (t typedValue) decode(s string) (interface{}, error) {
+	var res interface{}
+	var err error
+	switch t.Kind {
+	case boolValue:
+		res, err = strconv.ParseBool(s)
+	case intValue:
+		res, err = strconv.Atoi(s)
+	default:
+		// driver options take the type of the value of the variable
+		if err := yaml.Unmarshal([]byte(s), &res); err != nil || !isScalar(res) || res == nil {
+			return s, nil
+		}
+		return res, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid value '%s' for '%s' (from %s): %s was expected",
+			s, t.path(), describeVars(t.Raw), t.Kind)
+	}
+	return res, nil
+}
+
+type typedValues []typedValue
+
+// get the values in a section
+func (values typedValues) sections(section string) typedValues {
+	res := typedValues{}
+	for _, t := range values {
+		if t.Section == section {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// get the values that are not in a section
+func (values typedValues) without(section string) typedValues {
+	res := typedValues{}
+	for _, t := range values {
+		if t.Section != section {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// get the values that are not set in a tree with sections
+func (values typedValues) drop(tree yaml.MapSlice) typedValues {
+	set := map[string]bool{}
+	for _, item := range tree {
+		section := fmt.Sprint(item.Key)
+		keys, _ := item.Value.(yaml.MapSlice)
+		if section == "driver" && len(keys) > 0 {
+			keys, _ = keys[0].Value.(yaml.MapSlice)
+		}
+		for _, k := range keys {
+			set[keysPath(section, fmt.Sprint(k.Key))] = true
+		}
+	}
+
+	res := typedValues{}
+	for _, t := range values {
+		if !set[t.path()] {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// take out the typed values with variables from the sections in a tree,
+// so the sections can be decoded
+func extractTyped(tree yaml.MapSlice) (yaml.MapSlice, typedValues) {
+	res := typedValues{}
+	for i, item := range tree {
+		key := fmt.Sprint(item.Key)
+		section, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "engine", "swarm":
+			schema := engineSchema
+			if key == "swarm" {
+				schema = swarmSchema
+			}
+			kept := yaml.MapSlice{}
+			for _, option := range section {
+				s, isString := option.Value.(string)
+				kind := schema[fmt.Sprint(option.Key)]
+				if isString && hasVars(s) && (kind == boolValue || kind == intValue) {
+					res = append(res, typedValue{Section: key, Key: fmt.Sprint(option.Key), Raw: s, Kind: kind})
+					continue
+				}
+				kept = append(kept, option)
+			}
+			tree[i].Value = kept
+
+		case "driver":
+			// driver options can be of any type, so they are kept (as strings)
+			// and converted when the value is just a variable
+			for _, d := range section {
+				options, _ := d.Value.(yaml.MapSlice)
+				for _, option := range options {
+					if s, isString := option.Value.(string); isString && isSingleVarRef(s) {
+						res = append(res, typedValue{Section: key, Key: fmt.Sprint(option.Key), Raw: s, Kind: scalarValue})
+					}
+				}
+			}
+		}
+	}
+	return tree, res
+}
+
+// decode the typed values in a machine, replacing the variables (and
+// reporting the undefined ones, that leave the default values)
+func (machine *machineConfig) applyTyped(root *Config, vars map[string]string, undefined *validator) error {
+	for _, t := range machine.typed {
+		key := t.path()
+		if t.Section == "driver" {
+			key = keysPath(t.Section, machine.Driver.Name, t.Key)
+		}
+		path := root.machinePath(machine, key)
+
+		s := t.Raw
+		if t.Section == "driver" {
+			// the option could have been changed by an override
+			current, isString := machine.Driver.Options[t.Key].(string)
+			if !isString {
+				continue
+			}
+			s = current
+		}
+
+		s, err := replaceVars(s, vars)
+		if err != nil {
+			if u, ok := err.(unknownVarsError); ok {
+				if t.Section != "driver" {
+					// driver options are strings for now, and they are checked later
+					undefined.errorf(path, machine.Name, "undefined %s in '%s'", describeVarNames(u), key)
+				}
+				continue
+			}
+			return root.errorAt(path, machine.Name, "%s", err)
+		}
+		value, err := t.decode(s)
+		if err != nil {
+			return root.errorAt(path, machine.Name, "%s", err)
+		}
+
+		switch t.Section {
+		case "engine":
+			switch t.Key {
+			case "tls-verify":
+				machine.Engine.TLSVerify = value.(bool)
+			case "se-linux-enabled":
+				machine.Engine.SelinuxEnabled = value.(bool)
+			case "ipv6":
+				machine.Engine.Ipv6 = value.(bool)
+			}
+		case "swarm":
+			switch t.Key {
+			case "master":
+				machine.Swarm.Master = value.(bool)
+			}
+		case "driver":
+			machine.Driver.Options[t.Key] = value
+		}
+	}
+	machine.typed = nil
+	return nil
+}
+
+// check if a string is just a reference to a variable, like "$(CPUS)"
+func isSingleVarRef(s string) bool {
+	count := 0
+	rest := replaceVarsFunc(s, func(string) string {
+		count++
+		return ""
+	})
+	return count == 1 && len(rest) == 0
+}
+
+// describe the variables used in a value, like "variable 'TLS'"
+func describeVars(s string) string {
+	return describeVarNames(varNames(s))
+}
+
+func describeVarNames(names []string) string {
+	quoted := []string{}
+	for _, name := range names {
+		quoted = append(quoted, fmt.Sprintf("'%s'", name))
+	}
+	if len(quoted) == 1 {
+		return "variable " + quoted[0]
+	}
+	return "variables " + strings.Join(quoted, ", ")
+}
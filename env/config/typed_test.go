@@ -0,0 +1,80 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPopulateTypedVars(t *testing.T) {
+	const test_config_typed = `
+vars:
+  TLS:  false
+  CPUS: 4
+engine:
+  tls-verify: $(TLS)
+driver:
+  virtualbox:
+    cpu-count: $(CPUS)
+    memory:    $(CPUS * 1024)
+    hostname:  host-$(CPUS)
+machines:
+  master:
+    instances: 1
+    engine:
+      tls-verify: $(TLS)
+      ipv6:       $(machine.count > 1)
+  worker:
+    instances: 3
+    swarm:
+      master: $(# == 1)
+    overrides:
+      3:
+        swarm:
+          master: $(TLS)
+`
+
+	cfg := config.Config{}
+	err := yaml.Unmarshal([]byte(test_config_typed), &cfg)
+	require.NoError(t, err, "config parsing error")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+
+	require.Len(t, cfg.Machines, 4, "wrong number of machines")
+	master := cfg.Machines["master"]
+	require.False(t, master.Engine.TLSVerify, "tls-verify mismatch")
+	require.False(t, master.Engine.Ipv6, "ipv6 mismatch")
+	require.Equal(t, 4, master.Driver.Options["cpu-count"], "cpu-count must be an integer")
+	require.Equal(t, 4096, master.Driver.Options["memory"], "memory must be an integer")
+	require.Equal(t, "host-4", master.Driver.Options["hostname"], "hostname must be a string")
+
+	require.False(t, cfg.Machines["worker-1"].Engine.TLSVerify, "global tls-verify mismatch")
+	require.True(t, cfg.Machines["worker-1"].Swarm.Master, "worker-1 must be the swarm master")
+	require.False(t, cfg.Machines["worker-2"].Swarm.Master, "worker-2 must not be the swarm master")
+	require.False(t, cfg.Machines["worker-3"].Swarm.Master, "the override must be decoded")
+}
+
+func TestPopulateTypedVarsErrors(t *testing.T) {
+	for _, test := range []struct {
+		config string
+		err    string
+	}{
+		{
+			config: "vars: {TLS: maybe}\nmachines: {master: {instances: 1, engine: {tls-verify: $(TLS)}}}",
+			err:    "machine 'master': engine.tls-verify: invalid value 'maybe' for 'engine.tls-verify' (from variable 'TLS'): a boolean was expected",
+		},
+		{
+			config: "swarm: {master: $(IS_MASTER)}\nmachines: {master: {instances: 1}}",
+			err:    "machine 'master': swarm.master: undefined variable 'IS_MASTER' in 'swarm.master'",
+		},
+	} {
+		cfg := config.Config{}
+		err := yaml.Unmarshal([]byte(test.config), &cfg)
+		require.NoError(t, err, "config parsing error")
+		err = cfg.Populate(nil, nil, nil)
+		require.Error(t, err, "%s", test.config)
+		require.Contains(t, err.Error(), test.err)
+	}
+}
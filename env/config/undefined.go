@@ -0,0 +1,90 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// SetAllowUndefined sets if references to undefined variables are allowed,
+// leaving them untouched in the values (instead of failing when populating)
+func (config *Config) SetAllowUndefined(allow bool) {
+	config.allowUndefined = allow
+}
+
+// get the path of a key in a machine, like "engine.labels", in the machine
+// definition or in the global section it was taken from
+func (config *Config) machinePath(machine *machineConfig, key string) string {
+	section := strings.SplitN(key, ".", 2)[0]
+	if _, found := treeLookup(config.tree, machinesKey, machine.definition, section); found {
+		return keysPath(machinesKey, machine.definition, key)
+	}
+	return key
+}
+
+// check the strings in a (populated) machine for references to undefined
+// variables, with an error for every field where they appear
+func (v *validator) validateUndefinedVars(machine *machineConfig, vars map[string]string) {
+	// get the variables in a string that are not defined
+	undefined := func(s string) []string {
+		if !hasVars(s) {
+			return nil
+		}
+		_, err := replaceVars(s, vars)
+		if u, ok := err.(unknownVarsError); ok {
+			return u
+		}
+		return nil
+	}
+
+	if names := undefined(machine.Name); len(names) > 0 {
+		v.errorf(keysPath(machinesKey, machine.definition), machine.Name,
+			"undefined %s in the machine name", describeVarNames(names))
+	}
+
+	tree, err := normalizeTree(machine)
+	if err != nil {
+		return
+	}
+	flattenTree(tree, "", func(path string, value interface{}) {
+		values := []interface{}{value}
+		if lst, ok := value.([]interface{}); ok {
+			values = lst
+		}
+		for _, e := range values {
+			s, _ := e.(string)
+			if names := undefined(s); len(names) > 0 {
+				v.errorf(v.config.machinePath(machine, path), machine.Name,
+					"undefined %s in '%s'", describeVarNames(names), path)
+			}
+		}
+	})
+}
+
+// add an error found somewhere else, like when resolving variables
+func (v *validator) add(err error) {
+	e, ok := err.(ValidationError)
+	if !ok {
+		e = ValidationError{Message: err.Error()}
+	}
+	for _, other := range v.errs {
+		if other == e {
+			return
+		}
+	}
+	v.errs = append(v.errs, e)
+}
+
+// fail with all the references to undefined variables found, unless they are allowed
+func (v *validator) checkUndefinedVars() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	if v.config.allowUndefined {
+		for _, err := range v.errs {
+			log.Warnf("%s", err)
+		}
+		return nil
+	}
+	return v.errs
+}
@@ -0,0 +1,86 @@
+package config_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPopulateUndefinedVars(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+vars:
+  SWARM_DISCOVERY: token://1234
+swarm:
+  discovery: $(SWARM_DISCOVRY)
+machines:
+  master:
+    instances: 1
+    engine:
+      labels: [role=master, zone=$(ZONE)]
+  worker:
+    instances: 2
+    driver:
+      virtualbox:
+        hostname: worker-$(#)-$(SUFFIX)
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.NoError(t, err)
+	err = cfg.Populate(nil, nil, nil)
+	require.Error(t, err, "undefined variables must be reported")
+
+	errs, ok := err.(config.ValidationErrors)
+	require.True(t, ok, "a list of errors was expected, but got %T", err)
+	require.Len(t, errs, 3, "wrong number of errors: %s", err)
+	require.Contains(t, err.Error(), "docker-env.yml:5: machine 'master': swarm.discovery: undefined variable 'SWARM_DISCOVRY' in 'swarm.discovery'")
+	require.Contains(t, err.Error(), "docker-env.yml:10: machine 'master': machines.master.engine.labels: undefined variable 'ZONE' in 'engine.labels'")
+	require.Contains(t, err.Error(), "docker-env.yml:15: machine 'worker-1': machines.worker.driver.virtualbox.hostname: undefined variable 'SUFFIX' in 'driver.virtualbox.hostname'")
+
+	// undefined variables can be allowed (and left untouched)
+	cfg, err = config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.NoError(t, err)
+	cfg.SetAllowUndefined(true)
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+	require.Equal(t, "$(SWARM_DISCOVRY)", cfg.Machines["master"].Swarm.Discovery)
+}
+
+func TestPopulateUndefinedVarsInVars(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+vars:
+  URL: consul://$(CONSUL_HOST)
+swarm:
+  discovery: $(URL)
+machines:
+  master:
+    instances: 1
+    engine:
+      labels: [zone=$(ZONE)]
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	// reported together with the other undefined variables
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.NoError(t, err)
+	err = cfg.Populate(nil, nil, nil)
+	require.Error(t, err, "undefined variables must be reported")
+
+	_, ok := err.(config.ValidationErrors)
+	require.True(t, ok, "a list of errors was expected, but got %T", err)
+	require.Contains(t, err.Error(), "docker-env.yml:3: vars.URL: variable 'URL' references an undefined variable 'CONSUL_HOST'")
+	require.Contains(t, err.Error(), "undefined variable 'ZONE' in 'engine.labels'")
+
+	// and left untouched when they are allowed
+	cfg, err = config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.NoError(t, err)
+	cfg.SetAllowUndefined(true)
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+	require.Equal(t, "consul://$(CONSUL_HOST)", cfg.Machines["master"].Swarm.Discovery)
+}
@@ -0,0 +1,414 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/mcnflag"
+	"gopkg.in/yaml.v2"
+)
+
+// valid machine names (the same rules docker-machine uses)
+var machineNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9\-\.]*$`)
+
+// ValidationError is an error found in the configuration
+type ValidationError struct {
+	Position Position
+	Machine  string
+	Path     string
+	Message  string
+}
+
+func (e ValidationError) Error() string {
+	s := ""
+	if e.Position.IsValid() {
+		s += e.Position.String() + ": "
+	}
+	if len(e.Machine) > 0 {
+		s += fmt.Sprintf("machine '%s': ", e.Machine)
+	}
+	if len(e.Path) > 0 {
+		s += e.Path + ": "
+	}
+	return s + e.Message
+}
+
+// ValidationErrors is a list of errors found in the configuration
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := []string{}
+	for _, e := range errs {
+		lines = append(lines, e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type valueKind int
+
+const (
+	scalarValue valueKind = iota
+	boolValue
+	intValue
+	listValue
+	mapValue
+	listOrMapValue
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case boolValue:
+		return "a boolean"
+	case intValue:
+		return "an integer"
+	case listValue:
+		return "a list"
+	case mapValue:
+		return "a map"
+	case listOrMapValue:
+		return "a list or a map"
+	}
+	return "a single value"
+}
+
+// sectionSchema describes the keys that can be used in a section
+type sectionSchema map[string]valueKind
+
+// an error in some path of the configuration
+func (config *Config) errorAt(path, machine string, format string, args ...interface{}) error {
+	return ValidationError{
+		Position: config.positions.lookup(path),
+		Machine:  machine,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Validate checks the configuration, returning the list of errors found
+// (as ValidationErrors). It must be called after populating the configuration.
+//
+// Driver options are checked against the flags of the drivers, so drivers
+// are not checked when no API is provided.
+func (config *Config) Validate(api libmachine.API) error {
+	v := validator{
+		config:  config,
+		drivers: map[string]map[string]mcnflag.Flag{},
+	}
+
+	if config.tree != nil {
+		v.validateTree(config.tree)
+	}
+	if config.Parallel < 0 {
+		v.errorf("parallel", "", "invalid number of parallel creations, %d", config.Parallel)
+	}
+	if _, err := config.Retry.policy(); err != nil {
+		v.errorf(retryKey, "", "%s", err)
+	}
+
+	for _, machine := range config.Machines.Ordered() {
+		v.validateMachine(api, machine)
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+type validator struct {
+	config  *Config
+	errs    ValidationErrors
+	drivers map[string]map[string]mcnflag.Flag
+}
+
+func (v *validator) errorf(path, machine string, format string, args ...interface{}) {
+	err := v.config.errorAt(path, machine, format, args...).(ValidationError)
+
+	// expanded machines share their definitions, so report errors only once
+	for _, e := range v.errs {
+		if e.Path == err.Path && e.Message == err.Message {
+			return
+		}
+	}
+	v.errs = append(v.errs, err)
+}
+
+// check the keys and values in the configuration tree
+func (v *validator) validateTree(tree yaml.MapSlice) {
+	v.validateSection("", tree, configSchema)
+	v.validateSections("", tree)
+	if retry, ok := treeMap(tree, retryKey); ok {
+		v.validateSection(retryKey, retry, retrySchema)
+	}
+
+	if machines, ok := treeMap(tree, machinesKey); ok {
+		for _, item := range machines {
+			path := keysPath(machinesKey, fmt.Sprint(item.Key))
+			if !validDefinitionName(fmt.Sprint(item.Key)) {
+				v.errorf(path, "", "invalid machine definition name '%v' (dots can only be used in variables)", item.Key)
+			}
+			def, ok := item.Value.(yaml.MapSlice)
+			if !ok {
+				if item.Value != nil {
+					v.errorf(path, "", "a machine definition must be a map")
+				}
+				continue
+			}
+			v.validateSection(path, def, machineSchema)
+			v.validateSections(path, def)
+			if overrides, ok := treeMap(def, overridesKey); ok {
+				for _, o := range overrides {
+					overridePath := keysPath(path, overridesKey, fmt.Sprint(o.Key))
+					if override, ok := o.Value.(yaml.MapSlice); ok {
+						v.validateSection(overridePath, override, overrideSchema)
+						v.validateSections(overridePath, override)
+					} else if o.Value != nil {
+						v.errorf(overridePath, "", "an override must be a map")
+					}
+				}
+			}
+			if placement, ok := treeMap(def, placementKey); ok {
+				v.validateSection(keysPath(path, placementKey), placement, placementSchema)
+			}
+			if retry, ok := treeMap(def, retryKey); ok {
+				v.validateSection(keysPath(path, retryKey), retry, retrySchema)
+			}
+			if forEach, ok := treeMap(def, forEachKey); ok {
+				for _, item := range forEach {
+					v.validateValue(keysPath(path, forEachKey, fmt.Sprint(item.Key)), item.Value, listValue)
+				}
+			}
+		}
+	}
+}
+
+// machine definition names cannot have dots (outside variables, like in
+// "web-$(each.region)"), as they would be ambiguous in the keys paths
+func validDefinitionName(name string) bool {
+	return !strings.Contains(varRegexp.ReplaceAllString(name, ""), ".")
+}
+
+// check the "vars", "auth", "engine", "driver" and "swarm" sections in a tree
+func (v *validator) validateSections(path string, tree yaml.MapSlice) {
+	join := func(key string) string {
+		if len(path) == 0 {
+			return key
+		}
+		return keysPath(path, key)
+	}
+
+	if vars, ok := treeMap(tree, "vars"); ok {
+		for _, item := range vars {
+			v.validateValue(keysPath(join("vars"), fmt.Sprint(item.Key)), item.Value, scalarValue)
+		}
+	}
+	if secrets, ok := treeMap(tree, secretsKey); ok && len(path) == 0 {
+		for _, item := range secrets {
+			secretPath := keysPath(secretsKey, fmt.Sprint(item.Key))
+			if s, ok := item.Value.(string); !ok || !strings.HasPrefix(s, EncryptedPrefix) {
+				v.errorf(secretPath, "", "secrets must be encrypted (with 'docker-env secrets encrypt')")
+			}
+		}
+	}
+
+	// sections in machines can have conditions
+	section := func(key string) (yaml.MapSlice, bool) {
+		res, ok := treeMap(tree, key)
+		if !ok || len(path) == 0 {
+			return res, ok
+		}
+		if i := treeIndex(res, whenKey); i >= 0 {
+			v.validateValue(keysPath(join(key), whenKey), res[i].Value, scalarValue)
+			res = append(res[:i:i], res[i+1:]...)
+		}
+		return res, true
+	}
+
+	for _, s := range []struct {
+		name   string
+		schema sectionSchema
+	}{
+		{"auth", authSchema},
+		{"engine", engineSchema},
+		{"swarm", swarmSchema},
+	} {
+		if section, ok := section(s.name); ok {
+			v.validateSection(join(s.name), section, s.schema)
+		}
+	}
+
+	if d, ok := section("driver"); ok {
+		if len(d) > 1 {
+			v.errorf(join("driver"), "", "only one driver can be specified")
+		}
+		for _, item := range d {
+			v.validateValue(keysPath(join("driver"), fmt.Sprint(item.Key)), item.Value, mapValue)
+		}
+	}
+}
+
+// check the keys in a section
+func (v *validator) validateSection(path string, section yaml.MapSlice, schema sectionSchema) {
+	for _, item := range section {
+		key := fmt.Sprint(item.Key)
+		keyPath := key
+		if len(path) > 0 {
+			keyPath = keysPath(path, key)
+		}
+		kind, found := schema[key]
+		if !found {
+			v.errorf(keyPath, "", "unknown key '%s'", key)
+			continue
+		}
+		v.validateValue(keyPath, item.Value, kind)
+	}
+}
+
+// check the type of a value
+func (v *validator) validateValue(path string, value interface{}, kind valueKind) {
+	if value == nil {
+		return
+	}
+	if s, ok := value.(string); ok && hasVars(s) {
+		return // we will know after replacing variables
+	}
+
+	valid := true
+	switch kind {
+	case scalarValue:
+		valid = isScalar(value)
+	case boolValue:
+		switch value.(type) {
+		case bool:
+		case string:
+			_, err := strconv.ParseBool(value.(string))
+			valid = err == nil
+		default:
+			valid = false
+		}
+	case intValue:
+		switch value.(type) {
+		case int:
+		case string:
+			_, err := strconv.Atoi(value.(string))
+			valid = err == nil
+		default:
+			valid = false
+		}
+	case listValue:
+		_, isList := value.([]interface{})
+		valid = isList || isScalar(value)
+	case mapValue:
+		_, valid = value.(yaml.MapSlice)
+	case listOrMapValue:
+		_, isList := value.([]interface{})
+		_, isMap := value.(yaml.MapSlice)
+		valid = isList || isMap || isScalar(value)
+	}
+
+	if !valid {
+		v.errorf(path, "", "%s was expected, but found '%v'", kind, value)
+	}
+}
+
+// check a (populated) machine
+func (v *validator) validateMachine(api libmachine.API, machine *machineConfig) {
+	path := keysPath(machinesKey, machine.definition)
+
+	if !machineNameRegexp.MatchString(machine.Name) {
+		v.errorf(path, machine.Name, "invalid machine name")
+	}
+	v.validateMachineRetry(machine)
+
+	if api == nil || machine.Driver == nil || len(machine.Driver.Name) == 0 {
+		return
+	}
+
+	flags, found := v.drivers[machine.Driver.Name]
+	if !found {
+		d, err := machine.Driver.plugin(api)
+		if err == nil {
+			flags, err = driverFlags(machine.Driver.Name, d)
+		}
+		if err != nil {
+			v.errorf(v.sectionPath(machine, "driver"), machine.Name, "%s", err)
+			return
+		}
+		v.drivers[machine.Driver.Name] = flags
+	}
+
+	// in order, so the errors are always reported in the same order
+	keys := []string{}
+	for key := range machine.Driver.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := machine.Driver.Options[key]
+		optionPath := keysPath(v.sectionPath(machine, "driver"), machine.Driver.Name, key)
+		f, found := flags[key]
+		if !found {
+			v.errorf(optionPath, machine.Name, "unknown option '%s' for driver '%s'", key, machine.Driver.Name)
+			continue
+		}
+		switch f.(type) {
+		case mcnflag.BoolFlag, *mcnflag.BoolFlag:
+			v.validateValue(optionPath, value, boolValue)
+		case mcnflag.IntFlag, *mcnflag.IntFlag:
+			v.validateValue(optionPath, value, intValue)
+		case mcnflag.StringSliceFlag, *mcnflag.StringSliceFlag:
+			v.validateValue(optionPath, value, listValue)
+		default:
+			v.validateValue(optionPath, value, scalarValue)
+		}
+	}
+}
+
+// check the retry policy of a machine, when it has its own "retry" section
+// (errors in the global section are reported only once)
+func (v *validator) validateMachineRetry(machine *machineConfig) {
+	path := v.sectionPath(machine, retryKey)
+	if path == retryKey {
+		if v.config.tree != nil {
+			return
+		}
+		// without the tree we cannot know where the section comes from
+		path = keysPath(machinesKey, machine.definition, retryKey)
+	}
+	// ignore the keys inherited from the global section, already checked
+	own := machine.Retry.Copy()
+	if global := v.config.Retry; own != nil && global != nil {
+		if own.Attempts == global.Attempts {
+			own.Attempts = ""
+		}
+		if own.Delay == global.Delay {
+			own.Delay = ""
+		}
+		if own.MaxDelay == global.MaxDelay {
+			own.MaxDelay = ""
+		}
+	}
+	if _, err := own.policy(); err != nil {
+		v.errorf(path, machine.Name, "%s", err)
+	}
+}
+
+// the path of a section of a machine, that could have been taken from the global section
+func (v *validator) sectionPath(machine *machineConfig, section string) string {
+	if _, found := treeLookup(v.config.tree, machinesKey, machine.definition, section); found {
+		return keysPath(machinesKey, machine.definition, section)
+	}
+	return section
+}
+
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case yaml.MapSlice, []interface{}:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,183 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/libmachine"
+	"github.com/stretchr/testify/require"
+)
+
+func loadAndValidate(t *testing.T, files map[string]string, names ...string) (string, error) {
+	dir := createFiles(t, files)
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load(names)
+	if err != nil {
+		return dir, err
+	}
+	api := libmachine.NewClient(mcndirs.GetBaseDir())
+	if err := cfg.Populate(api, cfg, nil); err != nil {
+		return dir, err
+	}
+	return dir, cfg.Validate(nil)
+}
+
+func TestValidateValid(t *testing.T) {
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": test_config,
+	})
+	defer os.RemoveAll(dir)
+	require.NoError(t, err)
+}
+
+func TestValidateUnknownKeys(t *testing.T) {
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+engine:
+  storage-drivers: aufs
+machines:
+  master:
+    instances: 1
+  worker:
+    instances: 2
+    swarm:
+      discovery:  token://1234
+      leader:     true
+`,
+		"docker-env-production.yml": `
+auth:
+  ca-private-key-path: /my/key.pem
+machines:
+  worker:
+    instance: 3
+`,
+	}, "production")
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	errs, ok := err.(config.ValidationErrors)
+	require.True(t, ok, "not a list of validation errors: %s", err)
+	require.Len(t, errs, 4, "wrong number of errors: %s", err)
+
+	base := filepath.Join(dir, "docker-env.yml")
+	production := filepath.Join(dir, "docker-env-production.yml")
+	positions := map[string]string{}
+	for _, e := range errs {
+		positions[e.Path] = e.Position.String()
+	}
+	require.Equal(t, map[string]string{
+		"engine.storage-drivers":       base + ":3",
+		"machines.worker.swarm.leader": base + ":11",
+		"auth.ca-private-key-path":     production + ":3",
+		"machines.worker.instance":     production + ":6",
+	}, positions, "positions mismatch")
+}
+
+func TestValidateTypes(t *testing.T) {
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+engine:
+  tls-verify: maybe
+machines:
+  master:
+    instances: 1
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), filepath.Join(dir, "docker-env.yml")+":3: engine.tls-verify: a boolean was expected")
+}
+
+func TestValidateInstances(t *testing.T) {
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+machines:
+  master:
+    instances: $(NUM_MASTERS)
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), filepath.Join(dir, "docker-env.yml")+":4")
+
+	dir, err = loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+machines:
+  master:
+    instances: -1
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), filepath.Join(dir, "docker-env.yml")+":4")
+}
+
+func TestValidateMachineNames(t *testing.T) {
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+machines:
+  my_master:
+    instances: 1
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), filepath.Join(dir, "docker-env.yml")+":3: machine 'my_master'")
+}
+
+func TestValidateDefinitionNames(t *testing.T) {
+	// dots would make the keys paths ambiguous, but can be used in variables
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+machines:
+  web:
+    instances: 1
+  web.prod:
+    instances: 1
+  db-$(each.zone):
+    for_each:
+      zone: [a, b]
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	errs, ok := err.(config.ValidationErrors)
+	require.True(t, ok, "not a list of validation errors: %s", err)
+	require.Len(t, errs, 1, "wrong number of errors: %s", err)
+	require.Equal(t, filepath.Join(dir, "docker-env.yml")+":5: machines.web.prod: invalid machine definition name 'web.prod' (dots can only be used in variables)", errs[0].Error())
+}
+
+func TestValidateParallel(t *testing.T) {
+	dir, err := loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+parallel: 3
+machines:
+  master:
+    instances: 1
+`,
+	})
+	defer os.RemoveAll(dir)
+	require.NoError(t, err)
+
+	dir, err = loadAndValidate(t, map[string]string{
+		"docker-env.yml": `
+parallel: -1
+machines:
+  master:
+    instances: 1
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), filepath.Join(dir, "docker-env.yml")+":2")
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	varFilesKey = "var-files"
+
+	// the prefix for variables taken from the environment, like in "$(env:HOME)"
+	envVarPrefix = "env:"
+)
+
+// a valid variable name in a "KEY=VALUE" file
+var varNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LoadVarFile loads the variables defined in a file, in YAML (for ".yml"
+// and ".yaml" files) or as "KEY=VALUE" lines (like in ".env" files).
+// Variables loaded take precedence over the variables already defined.
+func (config *Config) LoadVarFile(filename string) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Could not read variables file %s: %s", filename, err)
+	}
+
+	var vars yaml.MapSlice
+	if isConfigFilename(filename) {
+		vars, err = parseYAMLVarFile(filename, b)
+	} else {
+		vars, err = parseEnvVarFile(filename, b)
+	}
+	if err != nil {
+		return err
+	}
+
+	source := fmt.Sprintf("file %s", filename)
+	for _, item := range vars {
+		config.SetVar(fmt.Sprint(item.Key), fmt.Sprint(item.Value), source)
+	}
+	return nil
+}
+
+// parse a YAML file with a map of variables
+func parseYAMLVarFile(filename string, b []byte) (yaml.MapSlice, error) {
+	vars := yaml.MapSlice{}
+	if err := yaml.Unmarshal(b, &vars); err != nil {
+		return nil, fmt.Errorf("Parse error when reading variables file %s: %s", filename, err)
+	}
+	for i, item := range vars {
+		if !isScalar(item.Value) {
+			return nil, fmt.Errorf("Invalid variable '%v' in %s: a single value was expected", item.Key, filename)
+		}
+		if item.Value == nil {
+			vars[i].Value = ""
+		}
+	}
+	return vars, nil
+}
+
+// parse a file with "KEY=VALUE" lines, ignoring empty lines and comments
+func parseEnvVarFile(filename string, b []byte) (yaml.MapSlice, error) {
+	vars := yaml.MapSlice{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		pos := Position{File: filename, Line: lineNum}
+		components := strings.SplitN(line, "=", 2)
+		if len(components) != 2 {
+			return nil, fmt.Errorf("%s: a 'KEY=VALUE' definition was expected", pos)
+		}
+		key, value := strings.TrimSpace(components[0]), strings.TrimSpace(components[1])
+		if !varNameRegexp.MatchString(key) {
+			return nil, fmt.Errorf("%s: invalid variable name '%s'", pos, key)
+		}
+
+		if len(value) >= 2 {
+			switch value[0] {
+			case '"':
+				unquoted, err := strconv.Unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: invalid quoted value for '%s'", pos, key)
+				}
+				value = unquoted
+			case '\'':
+				if value[len(value)-1] != '\'' {
+					return nil, fmt.Errorf("%s: invalid quoted value for '%s'", pos, key)
+				}
+				value = value[1 : len(value)-1]
+			}
+		}
+		vars = append(vars, yaml.MapItem{Key: key, Value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Could not read variables file %s: %s", filename, err)
+	}
+	return vars, nil
+}
+
+// lookup a variable, in the variables provided or in the environment
+// for variables like "env:HOME"
+func lookupVar(vars map[string]string, name string) (string, bool) {
+	if strings.HasPrefix(name, envVarPrefix) {
+		return lookupEnv(name[len(envVarPrefix):])
+	}
+	v, found := vars[name]
+	return v, found
+}
+
+// lookup an environment variable, telling unset variables from empty ones
+func lookupEnv(name string) (string, bool) {
+	if v := os.Getenv(name); len(v) > 0 {
+		return v, true
+	}
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, name+"=") {
+			return "", true
+		}
+	}
+	return "", false
+}
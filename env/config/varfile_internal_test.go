@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupEnv(t *testing.T) {
+	os.Setenv("DOCKER_ENV_TEST_EMPTY", "")
+	defer os.Unsetenv("DOCKER_ENV_TEST_EMPTY")
+	os.Unsetenv("DOCKER_ENV_TEST_UNSET")
+
+	v, found := lookupVar(nil, "env:DOCKER_ENV_TEST_EMPTY")
+	require.True(t, found, "empty variables are set")
+	require.Equal(t, "", v)
+
+	_, found = lookupVar(nil, "env:DOCKER_ENV_TEST_UNSET")
+	require.False(t, found)
+
+	// not confused by variables with the same prefix
+	os.Setenv("DOCKER_ENV_TEST_UNSET_2", "value")
+	defer os.Unsetenv("DOCKER_ENV_TEST_UNSET_2")
+	_, found = lookupVar(nil, "env:DOCKER_ENV_TEST_UNSET")
+	require.False(t, found)
+}
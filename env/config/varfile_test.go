@@ -0,0 +1,84 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadVarFile(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"production.env": `
+# some comment
+NUM_WORKERS=5
+export SWARM_DISCOVERY = "token://1234"
+FLAVOR='large'
+EMPTY=
+`,
+		"production.yml": `
+NUM_WORKERS: 7
+DEBUG: true
+`,
+		"bad.env": `
+NUM_WORKERS 5
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	cfg := config.Config{}
+	require.NoError(t, cfg.LoadVarFile(filepath.Join(dir, "production.env")))
+	require.Equal(t, "5", cfg.Vars["NUM_WORKERS"])
+	require.Equal(t, "token://1234", cfg.Vars["SWARM_DISCOVERY"])
+	require.Equal(t, "large", cfg.Vars["FLAVOR"])
+	require.Equal(t, "", cfg.Vars["EMPTY"])
+
+	// the last file loaded takes precedence
+	require.NoError(t, cfg.LoadVarFile(filepath.Join(dir, "production.yml")))
+	require.Equal(t, "7", cfg.Vars["NUM_WORKERS"])
+	require.Equal(t, "true", cfg.Vars["DEBUG"])
+
+	err := cfg.LoadVarFile(filepath.Join(dir, "bad.env"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "bad.env:2")
+
+	require.Error(t, cfg.LoadVarFile(filepath.Join(dir, "unknown.env")))
+}
+
+func TestLoaderVarFiles(t *testing.T) {
+	dir := createFiles(t, map[string]string{
+		"docker-env.yml": `
+vars:
+  NUM_WORKERS: 1
+  FLAVOR:      tiny
+var-files: [vars/common.env]
+machines:
+  worker:
+    instances: $(NUM_WORKERS)
+    driver:
+      openstack:
+        flavor-name: $(FLAVOR)
+        image-name:  $(env:DOCKER_ENV_TEST_IMAGE)
+`,
+		"vars/common.env": `
+NUM_WORKERS=3
+`,
+	})
+	defer os.RemoveAll(dir)
+	os.Setenv("DOCKER_ENV_TEST_IMAGE", "Ubuntu 14.04 LTS")
+	defer os.Unsetenv("DOCKER_ENV_TEST_IMAGE")
+
+	cfg, err := config.NewLoader(dir, config.MergeOptions{}).Load(nil)
+	require.NoError(t, err)
+	require.Equal(t, "3", cfg.Vars["NUM_WORKERS"], "var-files must override the vars section")
+	require.Equal(t, "tiny", cfg.Vars["FLAVOR"])
+
+	// the command line overrides everything
+	cfg.SetVar("NUM_WORKERS", "2", "the command line")
+	require.NoError(t, cfg.Populate(nil, nil, nil))
+	require.Len(t, cfg.Machines, 2, "wrong number of machines")
+	require.Equal(t, "Ubuntu 14.04 LTS", cfg.Machines["worker-1"].Driver.Options["image-name"])
+}
@@ -0,0 +1,94 @@
+package env
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnerror"
+	"github.com/docker/machine/libmachine/state"
+)
+
+// permanentError is an error that must not be retried
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// Permanent marks an error so the operation is not retried
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// the messages of the errors that are never retried, as docker-machine
+// usually formats errors in its own messages instead of wrapping them
+var permanentMessages = []string{
+	"Host already exists",
+	"Host does not exist",
+	mcnerror.ErrInvalidHostname.Error(),
+}
+
+// IsRetryable classifies the errors returned by driver operations: only
+// the operations that fail with retryable errors are retried
+var IsRetryable = func(err error) bool {
+	switch err.(type) {
+	case *permanentError, mcnerror.ErrHostAlreadyExists, mcnerror.ErrHostDoesNotExist:
+		return false
+	}
+	if err == mcnerror.ErrInvalidHostname {
+		return false
+	}
+	for _, msg := range permanentMessages {
+		if strings.Contains(err.Error(), msg) {
+			return false
+		}
+	}
+	return true
+}
+
+// Retry runs an operation for a host, retrying it with the policy
+// when it fails with a retryable error
+func Retry(policy config.RetryPolicy, operation string, name string, f func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = f(); err == nil || attempt >= policy.Attempts || !IsRetryable(err) {
+			return err
+		}
+		delay := policy.Backoff(attempt)
+		log.Infof("Error in %s for %s (attempt %d/%d), retrying in %s: %s",
+			operation, name, attempt, policy.Attempts, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// RetryCreate creates a host with create (usually, the Create of the API),
+// retrying it with the policy. A failed creation can leave the machine
+// created (like when provisioning fails after the driver has created it),
+// so it is removed with the driver before creating it again.
+func RetryCreate(policy config.RetryPolicy, h *host.Host, create func(*host.Host) error) error {
+	attempt := 0
+	return Retry(policy, "create", h.Name, func() error {
+		if attempt++; attempt > 1 {
+			if err := removePartialHost(h); err != nil {
+				return Permanent(fmt.Errorf("could not remove %s before creating it again: %s", h.Name, err))
+			}
+		}
+		return create(h)
+	})
+}
+
+// remove a host left by a failed creation, if the driver created it
+func removePartialHost(h *host.Host) error {
+	s, err := h.Driver.GetState()
+	if err != nil || s == state.None {
+		// drivers cannot get the state of machines that do not exist
+		return nil
+	}
+	log.Infof("Removing %s (%s), left by the failed creation", h.Name, s)
+	return h.Driver.Remove()
+}
@@ -0,0 +1,80 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/mcnerror"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/require"
+)
+
+// a driver that only knows if the machine exists
+type fakeDriver struct {
+	drivers.Driver
+	vms     int
+	removed int
+}
+
+func (d *fakeDriver) GetState() (state.State, error) {
+	if d.vms == 0 {
+		return state.None, errors.New("machine not found")
+	}
+	return state.Running, nil
+}
+
+func (d *fakeDriver) Remove() error {
+	d.vms--
+	d.removed++
+	return nil
+}
+
+func TestRetryCreateAfterVMExists(t *testing.T) {
+	d := &fakeDriver{}
+	h := &host.Host{Name: "worker-1", Driver: d}
+	policy := config.RetryPolicy{Attempts: 3}
+
+	// the VM is created, but provisioning fails the first time
+	attempts := 0
+	err := RetryCreate(policy, h, func(h *host.Host) error {
+		attempts++
+		d.vms++
+		if attempts == 1 {
+			return fmt.Errorf("Error running provisioning: connection refused")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, attempts)
+	require.Equal(t, 1, d.removed, "the first VM was not removed")
+	require.Equal(t, 1, d.vms, "some VM was orphaned")
+
+	// when nothing was created, nothing is removed
+	d = &fakeDriver{}
+	h = &host.Host{Name: "worker-2", Driver: d}
+	attempts = 0
+	err = RetryCreate(policy, h, func(h *host.Host) error {
+		if attempts++; attempts == 1 {
+			return fmt.Errorf("Error creating machine: quota exceeded")
+		}
+		d.vms++
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 0, d.removed)
+}
+
+func TestIsRetryable(t *testing.T) {
+	require.True(t, IsRetryable(errors.New("connection reset by peer")))
+	require.False(t, IsRetryable(mcnerror.ErrHostAlreadyExists{Name: "master"}))
+	require.False(t, IsRetryable(fmt.Errorf("Error creating machine: %s", mcnerror.ErrHostAlreadyExists{Name: "master"})))
+	require.False(t, IsRetryable(mcnerror.ErrHostDoesNotExist{Name: "master"}))
+	require.False(t, IsRetryable(fmt.Errorf("Error loading host: %s", mcnerror.ErrHostDoesNotExist{Name: "master"})))
+	require.False(t, IsRetryable(mcnerror.ErrInvalidHostname))
+	require.False(t, IsRetryable(Permanent(errors.New("timeout"))))
+}
@@ -0,0 +1,169 @@
+package env
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/host"
+)
+
+// Scheduler runs an action for many hosts at the same time, with some limits
+// so cloud providers do not rate limit us
+type Scheduler struct {
+	// the max number of actions running at the same time (no limit when not positive)
+	MaxInFlight int
+
+	// the max number of actions started per second for the hosts of the same
+	// driver (no limit when not positive)
+	RateLimit float64
+
+	// the rate limits for some drivers, instead of RateLimit
+	RateLimits map[string]float64
+
+	// the max random delay before starting an action
+	Jitter time.Duration
+
+	// the time of the next action for every driver, shared by all the runs
+	// (and by the copies of the scheduler)
+	limiter *rateLimiter
+}
+
+// NewScheduler creates a scheduler with a max number of actions in flight
+func NewScheduler(maxInFlight int) *Scheduler {
+	return &Scheduler{MaxInFlight: maxInFlight, limiter: newRateLimiter()}
+}
+
+// DefaultScheduler is the scheduler used by RunActionForeachMachine
+var DefaultScheduler = NewScheduler(10)
+
+// protects the creation of the limiters in schedulers not created with NewScheduler
+var limitersLock sync.Mutex
+
+// SetRateLimits parses the rate limits, like "0.5" for all the drivers
+// or "virtualbox=2,openstack=0.5" for some drivers (or both, like
+// "0.5,virtualbox=2")
+func (s *Scheduler) SetRateLimits(spec string) error {
+	for _, limit := range strings.Split(spec, ",") {
+		limit = strings.TrimSpace(limit)
+		if len(limit) == 0 {
+			continue
+		}
+		driver, rate := "", limit
+		if i := strings.Index(limit, "="); i >= 0 {
+			driver, rate = strings.TrimSpace(limit[:i]), strings.TrimSpace(limit[i+1:])
+			if len(driver) == 0 {
+				return fmt.Errorf("no driver in the rate limit '%s'", limit)
+			}
+		}
+		perSecond, err := strconv.ParseFloat(rate, 64)
+		if err != nil || perSecond < 0 {
+			return fmt.Errorf("invalid rate limit '%s'", limit)
+		}
+		if len(driver) == 0 {
+			s.RateLimit = perSecond
+			continue
+		}
+		if s.RateLimits == nil {
+			s.RateLimits = map[string]float64{}
+		}
+		s.RateLimits[driver] = perSecond
+	}
+	return nil
+}
+
+// the time between actions for a driver (zero for no limit)
+func (s *Scheduler) interval(driver string) time.Duration {
+	perSecond, found := s.RateLimits[driver]
+	if !found {
+		perSecond = s.RateLimit
+	}
+	if perSecond <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / perSecond)
+}
+
+// RunForeachHost runs a function for all the hosts, starting them in order.
+// It returns the errors, in the order of the hosts.
+func (s *Scheduler) RunForeachHost(hosts []*host.Host, f func(*host.Host) error) []error {
+	workers := s.MaxInFlight
+	if workers <= 0 || workers > len(hosts) {
+		workers = len(hosts)
+	}
+
+	limitersLock.Lock()
+	if s.limiter == nil {
+		s.limiter = newRateLimiter()
+	}
+	limitersLock.Unlock()
+
+	var (
+		results = make([]error, len(hosts))
+		pending = make(chan int)
+		wg      sync.WaitGroup
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pending {
+				driver := hosts[i].DriverName
+				s.limiter.wait(driver, s.interval(driver))
+				if s.Jitter > 0 {
+					time.Sleep(time.Duration(rand.Int63n(int64(s.Jitter))))
+				}
+				results[i] = f(hosts[i])
+			}
+		}()
+	}
+	for i := range hosts {
+		pending <- i
+	}
+	close(pending)
+	wg.Wait()
+
+	errs := []error{}
+	for _, err := range results {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// rateLimiter spaces the actions for the hosts of the same driver
+type rateLimiter struct {
+	sync.Mutex
+	next map[string]time.Time
+
+	// the clock (replaced in tests)
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{next: map[string]time.Time{}, now: time.Now, sleep: time.Sleep}
+}
+
+// wait until an action can be started for a driver
+func (l *rateLimiter) wait(driver string, interval time.Duration) {
+	if interval == 0 {
+		return
+	}
+
+	l.Lock()
+	now := l.now()
+	at := l.next[driver]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[driver] = at.Add(interval)
+	l.Unlock()
+
+	l.sleep(at.Sub(now))
+}
@@ -0,0 +1,62 @@
+package env
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/host"
+	"github.com/stretchr/testify/require"
+)
+
+// a clock that does not move, that records the times slept
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) install(s *Scheduler) {
+	s.limiter.now = func() time.Time { return c.now }
+	s.limiter.sleep = func(d time.Duration) { c.slept = append(c.slept, d) }
+}
+
+func TestSchedulerRateLimitBetweenRuns(t *testing.T) {
+	s := NewScheduler(10)
+	require.NoError(t, s.SetRateLimits("1000,fake=10"))
+	clock := &fakeClock{now: time.Now()}
+	clock.install(s)
+
+	// the budget of a driver is shared by all the runs (like the priority stages in "up")
+	hosts := []*host.Host{{Name: "a", DriverName: "fake"}}
+	run := func(*host.Host) error { return nil }
+	require.Empty(t, s.RunForeachHost(hosts, run))
+	require.Empty(t, s.RunForeachHost(hosts, run))
+
+	// and by the copies of the scheduler
+	c := *s
+	c.MaxInFlight = 1
+	require.Empty(t, c.RunForeachHost(hosts, run))
+	require.Equal(t, []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond}, clock.slept)
+
+	// other drivers use the global limit
+	clock.slept = nil
+	other := []*host.Host{{Name: "b", DriverName: "other"}}
+	require.Empty(t, s.RunForeachHost(other, run))
+	require.Empty(t, s.RunForeachHost(other, run))
+	require.Equal(t, []time.Duration{0, time.Millisecond}, clock.slept)
+}
+
+func TestSchedulerSetRateLimits(t *testing.T) {
+	s := NewScheduler(0)
+	require.NoError(t, s.SetRateLimits("virtualbox=2, openstack=0.5"))
+	require.Equal(t, 0.0, s.RateLimit)
+	require.Equal(t, map[string]float64{"virtualbox": 2, "openstack": 0.5}, s.RateLimits)
+	require.Equal(t, 2*time.Second, s.interval("openstack"))
+	require.Equal(t, time.Duration(0), s.interval("softlayer"))
+
+	require.NoError(t, s.SetRateLimits("4"))
+	require.Equal(t, 250*time.Millisecond, s.interval("softlayer"))
+
+	for _, spec := range []string{"fast", "-1", "=2", "virtualbox=fast"} {
+		require.Error(t, NewScheduler(0).SetRateLimits(spec), "error not detected for '%s'", spec)
+	}
+}
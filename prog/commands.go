@@ -2,11 +2,10 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 	"strings"
 
+	"github.com/inercia/docker-env/env"
 	"github.com/inercia/docker-env/env/config"
 	cmd "github.com/inercia/docker-env/prog/commands"
 
@@ -17,11 +16,6 @@ import (
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/ssh"
-	"gopkg.in/yaml.v2"
-)
-
-const (
-	defaultBasename = "docker-env"
 )
 
 var currDir = ""
@@ -46,6 +40,42 @@ var GlobalFlags = []cli.Flag{
 		Name:  "X, var",
 		Usage: "define a global variable (eg, '-X NUM_DATABASES=3')",
 	},
+	cli.StringSliceFlag{
+		Name:  "var-file",
+		Usage: "load global variables from a YAML or 'KEY=VALUE' file (eg, '--var-file production.env')",
+	},
+	cli.BoolFlag{
+		EnvVar: "DOCKER_ENV_ALLOW_UNDEFINED",
+		Name:   "allow-undefined",
+		Usage:  "leave references to undefined variables untouched instead of failing",
+	},
+	cli.StringFlag{
+		EnvVar: "DOCKER_ENV_SECRETS_KEY_FILE",
+		Name:   "secrets-key-file",
+		Usage:  "file with the key for the secrets (or use a passphrase in DOCKER_ENV_SECRETS_PASSPHRASE)",
+	},
+	cli.StringFlag{
+		EnvVar: "DOCKER_ENV_MERGE_LISTS",
+		Name:   "merge-lists",
+		Value:  "replace",
+		Usage:  "how lists are merged between configuration files ('replace' or 'append')",
+	},
+	cli.IntFlag{
+		EnvVar: "DOCKER_ENV_MAX_IN_FLIGHT",
+		Name:   "max-in-flight",
+		Value:  env.DefaultScheduler.MaxInFlight,
+		Usage:  "max number of machines started, stopped... at the same time (0 for no limit)",
+	},
+	cli.StringFlag{
+		EnvVar: "DOCKER_ENV_RATE_LIMIT",
+		Name:   "rate-limit",
+		Usage:  "max number of driver operations started per second, for every driver (eg, '0.5' or 'virtualbox=2,openstack=0.5')",
+	},
+	cli.DurationFlag{
+		EnvVar: "DOCKER_ENV_JITTER",
+		Name:   "jitter",
+		Usage:  "max random delay before every driver operation (eg, '500ms')",
+	},
 	cli.StringFlag{
 		EnvVar: "DOCKER_ENV_STORAGE_PATH",
 		Name:   "s, storage-path",
@@ -74,50 +104,102 @@ var Commands = []cli.Command{
 		Name:        "create",
 		Usage:       "Create a Docker environment",
 		Description: "Argument(s) are (optional) environment configuration files.",
-		Action:      runCommand(cmd.Create),
+		Action:      runCommand(cmd.Create, strictCheck),
+		Flags:       cmd.CreateFlags,
+	},
+	{
+		Name:        "up",
+		Usage:       "Create or start the hosts in an environment that are not running",
+		Description: "Argument(s) are (optional) environment configuration files.",
+		Action:      runCommand(cmd.Up, strictCheck),
+		Flags:       cmd.CreateFlags,
 	},
 	{
 		Name:        "rm",
 		Usage:       "Remove all the hosts in an environment",
 		Description: "Argument(s) are (optional) environment configuration files.",
-		Action:      runCommand(cmd.Rm),
+		Action:      runCommand(cmd.Rm, lenientCheck),
 		Flags:       cmd.RmFlags,
 	},
 	{
 		Name:        "start",
 		Usage:       "Start all the hosts in an environment",
 		Description: "Argument(s) are (optional) environment configuration files.",
-		Action:      runCommand(cmd.Start),
+		Action:      runCommand(cmd.Start, lenientCheck),
 	},
 	{
 		Name:        "stop",
 		Usage:       "Stop all the hosts in an environment",
 		Description: "Argument(s) are (optional) environment configuration files.",
-		Action:      runCommand(cmd.Stop),
+		Action:      runCommand(cmd.Stop, lenientCheck),
 	},
 	{
 		Name:        "kill",
 		Usage:       "Kill all the hosts in an environment",
 		Description: "Argument(s) are (optional) environment configuration files.",
-		Action:      runCommand(cmd.Kill),
+		Action:      runCommand(cmd.Kill, lenientCheck),
 	},
 	{
 		Name:        "status",
 		Usage:       "Get the status of the hosts in an environment",
 		Description: "Argument(s) are (optional) environment configuration files.",
-		Action:      runCommand(cmd.Status),
+		Action:      runCommand(cmd.Status, lenientCheck),
+	},
+	{
+		Name:        "validate",
+		Usage:       "Validate the configuration of an environment",
+		Description: "Argument(s) are (optional) environment configuration files.",
+		Action:      runCommand(cmd.Validate, strictCheck),
 	},
 	{
 		Name:   "version",
 		Usage:  "Show the docker-env version information",
-		Action: runCommand(cmd.Version),
+		Action: runCommand(cmd.Version, lenientCheck),
+	},
+	{
+		Name:        "config",
+		Usage:       "Show the resolved configuration of an environment",
+		Description: "Argument(s) are (optional) environment configuration files.",
+		Action:      runCommand(cmd.Config, configCheck),
+		Flags:       cmd.ConfigFlags,
+	},
+	{
+		Name:        "explain",
+		Usage:       "Explain where the configuration values of a machine come from",
+		Description: "Arguments are a machine name and (optionally) a key, like 'engine.storage-driver'.",
+		Action:      runCommand(cmd.Explain, lenientCheck),
+		Flags:       cmd.ExplainFlags,
 	},
 	{
 		Name:   "info",
 		Usage:  "Show some info",
-		Action: runCommand(cmd.Info),
+		Action: runCommand(cmd.Info, lenientCheck),
 		Flags:  cmd.InfoFlags,
 	},
+	{
+		Name:  "secrets",
+		Usage: "Manage the encrypted secrets",
+		Subcommands: []cli.Command{
+			{
+				Name:        "encrypt",
+				Usage:       "Encrypt some values for the 'secrets' section",
+				Description: "Arguments are the values (or they are read from stdin, one per line).",
+				Action:      runSecretsCommand(cmd.SecretsEncrypt),
+			},
+			{
+				Name:        "decrypt",
+				Usage:       "Decrypt some encrypted values",
+				Description: "Arguments are the values (or they are read from stdin, one per line).",
+				Action:      runSecretsCommand(cmd.SecretsDecrypt),
+			},
+			{
+				Name:        "edit",
+				Usage:       "Edit the secrets in a configuration file",
+				Description: "Argument is the file (by default, the docker-env.yml in the configuration directory).",
+				Action:      runSecretsCommand(cmd.SecretsEdit),
+			},
+		},
+	},
 }
 
 type contextCommandLine struct {
@@ -130,8 +212,36 @@ func (c *contextCommandLine) Application() *cli.App { return c.App }
 
 type commandFun func(commandLine commands.CommandLine, api libmachine.API, cfg *config.Config) error
 
+type secretsCommandFun func(commandLine commands.CommandLine, key config.SecretsKey) error
+
+// how the configuration is checked before running a command
+type checkMode int
+
+const (
+	// populate and validate the configuration, failing when it is not valid
+	checkStrict checkMode = iota
+	// populate the configuration, but only warn when it is not valid (for
+	// commands on existing machines, that must work after changing the configuration)
+	checkLenient
+	// do not populate nor validate the configuration (for showing it as it was loaded)
+	checkNone
+)
+
+type checkFun func(context *cli.Context) checkMode
+
+func strictCheck(*cli.Context) checkMode  { return checkStrict }
+func lenientCheck(*cli.Context) checkMode { return checkLenient }
+
+// the unresolved configuration must be shown even when it cannot be resolved
+func configCheck(context *cli.Context) checkMode {
+	if context.Bool("unresolved") {
+		return checkNone
+	}
+	return checkLenient
+}
+
 // runs a command
-func runCommand(cmd commandFun) func(context *cli.Context) {
+func runCommand(cmd commandFun, check checkFun) func(context *cli.Context) {
 	return func(context *cli.Context) {
 		log.Debugf("Creating API client")
 		api := libmachine.NewClient(mcndirs.GetBaseDir())
@@ -147,15 +257,35 @@ func runCommand(cmd commandFun) func(context *cli.Context) {
 		mcnutils.GithubAPIToken = api.GithubAPIToken
 		ssh.SetDefaultClient(api.SSHClientType)
 
+		// limits for the operations run for many machines at the same time
+		env.DefaultScheduler.MaxInFlight = context.GlobalInt("max-in-flight")
+		env.DefaultScheduler.Jitter = context.GlobalDuration("jitter")
+		if err := env.DefaultScheduler.SetRateLimits(context.GlobalString("rate-limit")); err != nil {
+			log.Fatalf("Invalid rate limits: %s", err)
+		}
+
 		// load the configuration file(s)
 		configDir := context.GlobalString("dir")
-		argsStrings := ([]string)(context.Args())
+		listsMerge, err := config.ParseListsMerge(context.GlobalString("merge-lists"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		mergeOpts := config.MergeOptions{Lists: listsMerge}
 		log.Debugf("Loading config from directory %s", configDir)
-		config, err := loadConfig(configDir, argsStrings)
+		cfg, err := config.NewLoader(configDir, mergeOpts).Load(environmentNames(context))
 		if err != nil {
 			log.Fatal(err)
 		}
 
+		// variables files and definitions in the command line override the
+		// variables in the configuration files (and in its "var-files"), in this order
+		for _, filename := range context.GlobalStringSlice("var-file") {
+			log.Debugf("Loading variables from %s", filename)
+			if err := cfg.LoadVarFile(filename); err != nil {
+				log.Fatal(err)
+			}
+		}
+
 		// parse variable definitions in the form "var=some_value"
 		for _, varDef := range context.GlobalStringSlice("var") {
 			varDefComponents := strings.SplitN(varDef, "=", 2)
@@ -164,69 +294,71 @@ func runCommand(cmd commandFun) func(context *cli.Context) {
 			}
 			key, value := varDefComponents[0], varDefComponents[1]
 			log.Debugf("Command line variable: %s = %s", key, value)
-			config.Vars[key] = value
-		}
-		err = config.Populate(api, nil, nil)
-		if err != nil {
-			log.Fatal(err)
+			cfg.SetVar(key, value, "the command line")
 		}
 
-		// TODO: verify the config
+		mode := check(context)
 
-		if err := cmd(&contextCommandLine{context}, api, config); err != nil {
-			log.Fatal(err)
+		// decrypt the secrets (only in memory)
+		if cfg.HasSecrets() && mode != checkNone {
+			key, err := secretsKey(context)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := cfg.DecryptSecrets(key); err != nil {
+				log.Fatal(err)
+			}
 		}
-	}
-}
-
-// load the environment configuration from file(s)
-func loadConfig(dir string, names []string) (*config.Config, error) {
-	config := &config.Config{}
-
-	load := func(basename string) error {
-		for _, filename := range []string{
-			filepath.Join(dir, fmt.Sprintf("%s.yml", basename)),
-			filepath.Join(dir, fmt.Sprintf("%s.yaml", basename)),
-		} {
-			log.Debugf("Trying to load '%s'", filename)
-			if b, err := ioutil.ReadFile(filename); err != nil {
-				if !os.IsNotExist(err) {
-					return err
-				}
-			} else {
-				if err = yaml.Unmarshal(b, &config); err != nil {
-					return fmt.Errorf("Parse error when reading %s: %s", filename, err)
-				} else {
-					log.Debugf("... '%s' successfully loaded", filename)
-					return nil
+		cfg.SetAllowUndefined(context.GlobalBool("allow-undefined"))
+		if mode != checkNone {
+			if err := cfg.Populate(api, nil, nil); err != nil {
+				log.Fatal(err)
+			}
+			if err := cfg.Validate(api); err != nil {
+				if mode == checkStrict {
+					log.Fatal(err)
 				}
+				log.Warnf("The configuration is not valid:\n%s", err)
 			}
 		}
 
-		log.Debug("No config file found")
-		return os.ErrNotExist
-	}
-
-	loaded := 0
-	err := load(defaultBasename)
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
+		if err := cmd(&contextCommandLine{context}, api, cfg); err != nil {
+			log.Fatal(err)
 		}
-	} else {
-		loaded++
 	}
+}
 
-	for _, name := range names {
-		err = load(fmt.Sprintf("%s-%s", defaultBasename, name))
+// runs a command that only needs the key for the secrets
+func runSecretsCommand(cmd secretsCommandFun) func(context *cli.Context) {
+	return func(context *cli.Context) {
+		key, err := secretsKey(context)
 		if err != nil {
-			return nil, err
+			log.Fatal(err)
+		}
+		if err := cmd(&contextCommandLine{context}, key); err != nil {
+			log.Fatal(err)
 		}
-		loaded++
 	}
-	if loaded == 0 {
-		return nil, fmt.Errorf("No configuration files found")
+}
+
+// get the key for the secrets, from a key file or from a passphrase in the environment
+func secretsKey(context *cli.Context) (config.SecretsKey, error) {
+	if filename := context.GlobalString("secrets-key-file"); len(filename) > 0 {
+		return config.LoadSecretsKeyFile(filename)
 	}
+	if passphrase := os.Getenv("DOCKER_ENV_SECRETS_PASSPHRASE"); len(passphrase) > 0 {
+		return config.SecretsKey(passphrase), nil
+	}
+	return nil, fmt.Errorf("A key for the secrets is needed: use --secrets-key-file or DOCKER_ENV_SECRETS_PASSPHRASE")
+}
 
-	return config, nil
+// get the names of the environments to load: the arguments, unless the command
+// takes other arguments (and then the names must be provided with "--env")
+func environmentNames(context *cli.Context) []string {
+	for _, f := range context.Command.Flags {
+		if f, ok := f.(cli.StringSliceFlag); ok && f.Name == cmd.EnvFlag.Name {
+			return context.StringSlice("env")
+		}
+	}
+	return ([]string)(context.Args())
 }
@@ -18,15 +18,6 @@ func runForHosts(actionName string, api libmachine.API, cfg *config.Config, igno
 	var hosts []*host.Host
 	var err error
 
-	consolidateErrs := func(errs []error) error {
-		finalErr := ""
-		for _, err := range errs {
-			finalErr = fmt.Sprintf("%s\n%s", finalErr, err)
-		}
-
-		return errors.New(strings.TrimSpace(finalErr))
-	}
-
 	if ignoreMissing {
 		hosts, err = cfg.Machines.LoadExistingHosts(api, func(name string) {
 			log.Infof("Host '%s' does not exist", name)
@@ -38,7 +29,7 @@ func runForHosts(actionName string, api libmachine.API, cfg *config.Config, igno
 		return err
 	}
 
-	if errs := env.RunActionForeachMachine(actionName, hosts); len(errs) > 0 {
+	if errs := env.RunActionForeachMachine(actionName, hosts, cfg.Machines.RetryPolicyOf); len(errs) > 0 {
 		return consolidateErrs(errs)
 	}
 	for _, h := range hosts {
@@ -48,3 +39,13 @@ func runForHosts(actionName string, api libmachine.API, cfg *config.Config, igno
 	}
 	return nil
 }
+
+// consolidate a list of errors in a single error
+func consolidateErrs(errs []error) error {
+	finalErr := ""
+	for _, err := range errs {
+		finalErr = fmt.Sprintf("%s\n%s", finalErr, err)
+	}
+
+	return errors.New(strings.TrimSpace(finalErr))
+}
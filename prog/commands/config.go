@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/commands"
+	"github.com/docker/machine/libmachine"
+	"gopkg.in/yaml.v2"
+)
+
+var ConfigFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "format, f",
+		Value: "yaml",
+		Usage: "output format ('yaml' or 'json')",
+	},
+	cli.StringFlag{
+		Name:  "machine, m",
+		Usage: "show only this machine",
+	},
+	cli.BoolFlag{
+		Name:  "unresolved, u",
+		Usage: "show the merged configuration, before replacing variables and expanding instances",
+	},
+}
+
+func Config(c commands.CommandLine, api libmachine.API, cfg *config.Config) error {
+	var tree yaml.MapSlice
+	var err error
+
+	if c.Bool("unresolved") {
+		tree, err = cfg.UnresolvedTree(c.String("machine"))
+	} else {
+		tree, err = cfg.ResolvedTree(c.String("machine"))
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := config.MarshalTree(tree, c.String("format"))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.WriteString(config.Redact(string(out)))
+	return err
+}
@@ -2,30 +2,188 @@ package commands
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/inercia/docker-env/env"
 	"github.com/inercia/docker-env/env/config"
 
+	"github.com/codegangsta/cli"
 	"github.com/docker/machine/commands"
 	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
 )
 
-func Create(c commands.CommandLine, api libmachine.API, cfg *config.Config) error {
+var CreateFlags = []cli.Flag{
+	cli.IntFlag{
+		Name:  "parallel, p",
+		Usage: "number of machines created at the same time (default: the 'parallel' in the configuration, or 1)",
+	},
+	cli.BoolFlag{
+		Name:  "atomic",
+		Usage: "remove all the machines created when some creation fails",
+	},
+}
 
+func Create(c commands.CommandLine, api libmachine.API, cfg *config.Config) error {
 	hosts, err := cfg.Machines.NewHosts(api)
 	if err != nil {
 		return err
 	}
+	return bringUp(c, api, cfg, hosts, func(*host.Host) bool { return true })
+}
 
-	for _, h := range hosts {
-		log.Infof("Bringing %s up", h.Name)
-		if err := api.Create(h); err != nil {
-			return fmt.Errorf("Error attempting to create %s: %s", h.Name, err)
+// bring up some hosts, creating the new ones and starting the existing
+// ones that are not running, with "--parallel" of them at the same time
+func bringUp(c commands.CommandLine, api libmachine.API, cfg *config.Config, hosts []*host.Host, isNew func(*host.Host) bool) error {
+	parallel := cfg.Parallel
+	if c.IsSet("parallel") {
+		parallel = c.Int("parallel")
+	}
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var (
+		mutex     sync.Mutex
+		done      = 0
+		failed    = false
+		attempted = []*host.Host{}
+	)
+	up := func(h *host.Host) error {
+		mutex.Lock()
+		skip := failed
+		mutex.Unlock()
+		if skip {
+			log.Infof("Skipping %s", h.Name)
+			return nil
 		}
-		if err := api.Save(h); err != nil {
-			return fmt.Errorf("Error attempting to save store: %s", err)
+
+		var what string
+		var err error
+		if isNew(h) {
+			mutex.Lock()
+			attempted = append(attempted, h)
+			mutex.Unlock()
+
+			log.Infof("Bringing %s up", h.Name)
+			what, err = "created", createHost(api, cfg, h)
+		} else {
+			var started bool
+			if started, err = startHost(api, cfg, h); started {
+				what = "started"
+			} else {
+				what = "already running"
+			}
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		if err != nil {
+			// do not start any other machine
+			failed = true
+			return err
 		}
+		done++
+		log.Infof("(%d/%d) %s %s", done, len(hosts), h.Name, what)
+		return nil
 	}
 
+	// machines with the same priority are brought up at the same time, and
+	// machines with lower priorities are not brought up until they are done
+	// (the copy shares the rate limits with the default scheduler)
+	scheduler := *env.DefaultScheduler
+	scheduler.MaxInFlight = parallel
+	for _, stage := range priorityStages(cfg, hosts) {
+		if errs := scheduler.RunForeachHost(stage, up); len(errs) > 0 {
+			if c.Bool("atomic") {
+				rollback(api, cfg, attempted)
+			}
+			return consolidateErrs(errs)
+		}
+	}
+
+	return nil
+}
+
+// create a new host, saving it in the store
+func createHost(api libmachine.API, cfg *config.Config, h *host.Host) error {
+	if err := env.RetryCreate(cfg.Machines.RetryPolicyOf(h.Name), h, api.Create); err != nil {
+		return fmt.Errorf("Error attempting to create %s: %s", h.Name, err)
+	}
+	if err := api.Save(h); err != nil {
+		return fmt.Errorf("Error attempting to save store: %s", err)
+	}
 	return nil
 }
+
+// start an existing host, unless it is already running
+func startHost(api libmachine.API, cfg *config.Config, h *host.Host) (bool, error) {
+	currentState, err := h.Driver.GetState()
+	if err != nil {
+		return false, fmt.Errorf("Error getting state for host %s: %s", h.Name, err)
+	}
+	if currentState == state.Running {
+		return false, nil
+	}
+
+	log.Infof("Starting %s (%s)", h.Name, currentState)
+	if err := env.Retry(cfg.Machines.RetryPolicyOf(h.Name), "start", h.Name, h.Start); err != nil {
+		return false, fmt.Errorf("Error attempting to start %s: %s", h.Name, err)
+	}
+	if err := api.Save(h); err != nil {
+		return false, fmt.Errorf("Error saving host to store: %s", err)
+	}
+	return true, nil
+}
+
+// split the (ordered) hosts in groups with the same priority
+func priorityStages(cfg *config.Config, hosts []*host.Host) [][]*host.Host {
+	stages := [][]*host.Host{}
+	for i, h := range hosts {
+		if i == 0 || cfg.Machines.PriorityOf(h.Name) != cfg.Machines.PriorityOf(hosts[i-1].Name) {
+			stages = append(stages, []*host.Host{})
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], h)
+	}
+	return stages
+}
+
+// remove the hosts created (or partially created) in a failed run, in the
+// reverse order, and print what was rolled back and what could not be
+func rollback(api libmachine.API, cfg *config.Config, hosts []*host.Host) {
+	rolledBack := []string{}
+	remaining := []string{}
+	for i := len(hosts) - 1; i >= 0; i-- {
+		h := hosts[i]
+		exists, err := api.Exists(h.Name)
+		if err == nil && !exists {
+			continue
+		}
+		if err == nil {
+			err = removeHost(api, cfg, h, false)
+		}
+		if err != nil {
+			log.Errorf("Error rolling back %s: %s", h.Name, err)
+			remaining = append(remaining, h.Name)
+			continue
+		}
+		log.Infof("Rolled back %s", h.Name)
+		rolledBack = append(rolledBack, h.Name)
+	}
+
+	log.Infof("Rollback summary:")
+	log.Infof("  rolled back: %s", namesList(rolledBack))
+	if len(remaining) > 0 {
+		log.Infof("  could not be rolled back (remove them with 'docker-env rm'): %s", namesList(remaining))
+	}
+}
+
+func namesList(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
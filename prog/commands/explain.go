@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/commands"
+	"github.com/docker/machine/libmachine"
+)
+
+// EnvFlag is the flag for providing the environment names in
+// commands that take other positional arguments
+var EnvFlag = cli.StringSliceFlag{
+	Name:  "env, e",
+	Value: &cli.StringSlice{},
+	Usage: "environment configuration file (eg, '-e production')",
+}
+
+var ExplainFlags = []cli.Flag{
+	EnvFlag,
+}
+
+func Explain(c commands.CommandLine, api libmachine.API, cfg *config.Config) error {
+	args := c.Args()
+	if len(args) < 1 || len(args) > 2 {
+		c.ShowHelp()
+		return fmt.Errorf("a machine name (and optionally a key) must be provided")
+	}
+
+	explanations, err := cfg.Explain(args.Get(0), args.Get(1))
+	if err != nil {
+		return err
+	}
+
+	// origins are printed from the lowest to the highest precedence,
+	// followed by the origins of the variables used
+	for _, e := range explanations {
+		fmt.Printf("%s = %s\n", e.Key, config.Redact(config.FormatValue(e.Value)))
+		for _, origin := range e.Origins {
+			fmt.Printf("    %s\n", config.Redact(origin.String()))
+		}
+	}
+	return nil
+}
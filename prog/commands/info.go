@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"fmt"
+
 	"github.com/inercia/docker-env/env/config"
 
 	"github.com/codegangsta/cli"
@@ -27,7 +29,7 @@ func Info(c commands.CommandLine, api libmachine.API, cfg *config.Config) error
 			SpewKeys: true,
 		}
 
-		scs.Dump(cfg)
+		fmt.Print(config.Redact(scs.Sdump(cfg)))
 	}
 
 	return nil
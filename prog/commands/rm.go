@@ -1,11 +1,15 @@
 package commands
 
 import (
+	"fmt"
+
+	"github.com/inercia/docker-env/env"
 	"github.com/inercia/docker-env/env/config"
 
 	"github.com/codegangsta/cli"
 	"github.com/docker/machine/commands"
 	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/log"
 )
 
@@ -26,15 +30,8 @@ func Rm(c commands.CommandLine, api libmachine.API, cfg *config.Config) error {
 		return err
 	}
 	for _, h := range hosts {
-		if err := h.Driver.Remove(); err != nil {
-			if !force {
-				log.Errorf("Provider error removing machine %q: %s", h.Name, err)
-				continue
-			}
-		}
-
-		if err := api.Remove(h.Name); err != nil {
-			log.Errorf("Error removing machine %q from store: %s", h.Name, err)
+		if err := removeHost(api, cfg, h, force); err != nil {
+			log.Errorf("%s", err)
 		} else {
 			log.Infof("Successfully removed %s", h.Name)
 		}
@@ -42,3 +39,17 @@ func Rm(c commands.CommandLine, api libmachine.API, cfg *config.Config) error {
 
 	return nil
 }
+
+// remove a host with its driver and then from the store (the host is kept
+// in the store when the driver fails, unless forced)
+func removeHost(api libmachine.API, cfg *config.Config, h *host.Host, force bool) error {
+	err := env.Retry(cfg.Machines.RetryPolicyOf(h.Name), "rm", h.Name, h.Driver.Remove)
+	if err != nil && !force {
+		return fmt.Errorf("Provider error removing machine %q: %s", h.Name, err)
+	}
+
+	if err := api.Remove(h.Name); err != nil {
+		return fmt.Errorf("Error removing machine %q from store: %s", h.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/docker/machine/commands"
+	"gopkg.in/yaml.v2"
+)
+
+// SecretsEncrypt encrypts the values provided (or read from stdin), for
+// using them in a "secrets" section
+func SecretsEncrypt(c commands.CommandLine, key config.SecretsKey) error {
+	values, err := argsOrStdin(c)
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		encrypted, err := key.Encrypt(value)
+		if err != nil {
+			return err
+		}
+		fmt.Println(encrypted)
+	}
+	return nil
+}
+
+// SecretsDecrypt decrypts the values provided (or read from stdin)
+func SecretsDecrypt(c commands.CommandLine, key config.SecretsKey) error {
+	values, err := argsOrStdin(c)
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		decrypted, err := key.Decrypt(value)
+		if err != nil {
+			return err
+		}
+		fmt.Println(decrypted)
+	}
+	return nil
+}
+
+// SecretsEdit opens the (decrypted) "secrets" section of a configuration
+// file in an editor, encrypting it back when the editor exits. Only the
+// "secrets" section is rewritten in the file.
+func SecretsEdit(c commands.CommandLine, key config.SecretsKey) error {
+	filename := c.Args().First()
+	if len(filename) == 0 {
+		filename = filepath.Join(c.GlobalString("dir"), config.DefaultBasename+".yml")
+	}
+
+	content := []byte{}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(filename); err == nil {
+		mode = info.Mode().Perm()
+		if content, err = ioutil.ReadFile(filename); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	current, err := config.SecretsInFile(content)
+	if err != nil {
+		return fmt.Errorf("Parse error when reading %s: %s", filename, err)
+	}
+
+	// decrypt the current secrets
+	encrypted := map[string]string{}
+	plaintexts := map[string]string{}
+	decrypted := yaml.MapSlice{}
+	for _, item := range current {
+		name, value := fmt.Sprint(item.Key), fmt.Sprint(item.Value)
+		plaintext, err := key.Decrypt(value)
+		if err != nil {
+			return fmt.Errorf("secret '%s': %s", name, err)
+		}
+		encrypted[name] = value
+		plaintexts[name] = plaintext
+		decrypted = append(decrypted, yaml.MapItem{Key: name, Value: plaintext})
+	}
+
+	edited, err := editTree(decrypted)
+	if err != nil {
+		return err
+	}
+
+	// encrypt the secrets again, keeping the values that did not change
+	secrets := yaml.MapSlice{}
+	for _, item := range edited {
+		name, value := fmt.Sprint(item.Key), fmt.Sprint(item.Value)
+		if previous, found := encrypted[name]; found && plaintexts[name] == value {
+			secrets = append(secrets, yaml.MapItem{Key: name, Value: previous})
+			continue
+		}
+		value, err := key.Encrypt(value)
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, yaml.MapItem{Key: name, Value: value})
+	}
+
+	b, err := config.ReplaceSecretsInFile(content, secrets)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, b, mode)
+}
+
+// edit a tree in a (private) temporary file with the user's editor
+func editTree(tree yaml.MapSlice) (yaml.MapSlice, error) {
+	f, err := ioutil.TempFile("", "docker-env-secrets")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	b, err := yaml.Marshal(tree)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if len(tree) == 0 {
+		b = []byte("# NAME: value\n")
+	}
+	_, err = f.Write(b)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if len(editor) == 0 {
+		editor = "vi"
+	}
+	cmd := exec.Command(editor, f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Error running the editor: %s", err)
+	}
+
+	if b, err = ioutil.ReadFile(f.Name()); err != nil {
+		return nil, err
+	}
+	res := yaml.MapSlice{}
+	if err := yaml.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("Parse error in the secrets: %s", err)
+	}
+	return res, nil
+}
+
+// get the values in the arguments or, when there are no arguments, the lines in stdin
+func argsOrStdin(c commands.CommandLine) ([]string, error) {
+	if len(c.Args()) > 0 {
+		return c.Args(), nil
+	}
+	res := []string{}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+			res = append(res, line)
+		}
+	}
+	return res, scanner.Err()
+}
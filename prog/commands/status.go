@@ -20,7 +20,7 @@ func Status(c commands.CommandLine, api libmachine.API, cfg *config.Config) erro
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
-	fmt.Fprintln(w, "NAME\tDRIVER\tSTATE\tURL\tERRORS")
+	fmt.Fprintln(w, "NAME\tDRIVER\tSTATE\tURL\tPLACEMENT\tERRORS")
 
 	for _, host := range hosts {
 		url := ""
@@ -38,8 +38,13 @@ func Status(c commands.CommandLine, api libmachine.API, cfg *config.Config) erro
 			}
 		}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
-			host.Name, host.DriverName, currentState, url, hostError)
+		placement := ""
+		if machine, found := cfg.Machines[host.Name]; found {
+			placement = machine.Placed()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			host.Name, host.DriverName, currentState, url, placement, hostError)
 
 	}
 	w.Flush()
@@ -0,0 +1,24 @@
+package commands
+
+import (
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/docker/machine/commands"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Up brings the environment up: the machines that do not exist are created,
+// the stopped machines are started and the running machines are left alone
+func Up(c commands.CommandLine, api libmachine.API, cfg *config.Config) error {
+	missing := map[string]bool{}
+	hosts, err := cfg.Machines.LoadOrNewHosts(api, func(name string) {
+		log.Debugf("Host '%s' does not exist", name)
+		missing[name] = true
+	})
+	if err != nil {
+		return err
+	}
+	return bringUp(c, api, cfg, hosts, func(h *host.Host) bool { return missing[h.Name] })
+}
@@ -0,0 +1,16 @@
+package commands
+
+import (
+	"github.com/inercia/docker-env/env/config"
+
+	"github.com/docker/machine/commands"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Validate does nothing but reporting: the configuration has been
+// validated before running any command
+func Validate(c commands.CommandLine, api libmachine.API, cfg *config.Config) error {
+	log.Infof("The configuration is valid (%d machines)", len(cfg.Machines))
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 	"path"
 	"strconv"
 
+	"github.com/inercia/docker-env/env/config"
+
 	"github.com/codegangsta/cli"
 	"github.com/docker/machine/libmachine/log"
 )
@@ -67,6 +69,10 @@ func setDebugOutputLevel() {
 func main() {
 	setDebugOutputLevel()
 
+	// never show the secrets in the logs
+	log.SetOutWriter(config.NewRedactingWriter(os.Stdout))
+	log.SetErrWriter(config.NewRedactingWriter(os.Stderr))
+
 	cli.AppHelpTemplate = AppHelpTemplate
 	cli.CommandHelpTemplate = CommandHelpTemplate
 	app := cli.NewApp()